@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// defaultInputRate is the sample rate assumed by the Live API for PCM
+// input audio, when the MIME type has no rate parameter.
+const defaultInputRate = 16000
+
+// pcmRate returns the sample rate of the "rate" parameter of an
+// audio/pcm MIME type, e.g. "audio/pcm;rate=24000", or def if absent.
+func pcmRate(mimeType string, def int) int {
+	_, params, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return def
+	}
+	rate, err := strconv.Atoi(params["rate"])
+	if err != nil || rate <= 0 {
+		return def
+	}
+	return rate
+}
+
+// wavWriter writes 16-bit mono PCM audio to a WAV file.
+// The sizes in the header are known only when the file is closed.
+type wavWriter struct {
+	f    *os.File
+	size int
+}
+
+func createWAV(path string, rate int) (*wavWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	const (
+		channels      = 1
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	// header[4:8] is the RIFF chunk size, see Close
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], channels)
+	binary.LittleEndian.PutUint32(header[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(rate*blockAlign))
+	binary.LittleEndian.PutUint16(header[32:], blockAlign)
+	binary.LittleEndian.PutUint16(header[34:], bitsPerSample)
+	copy(header[36:], "data")
+	// header[40:44] is the data chunk size, see Close
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &wavWriter{f: f}, nil
+}
+
+func (w *wavWriter) Write(pcm []byte) (int, error) {
+	n, err := w.f.Write(pcm)
+	w.size += n
+	return n, err
+}
+
+// Close writes the sizes in the header, and closes the file.
+func (w *wavWriter) Close() error {
+	var sizes [4]byte
+	binary.LittleEndian.PutUint32(sizes[:], uint32(36+w.size))
+	if _, err := w.f.WriteAt(sizes[:], 4); err != nil {
+		w.f.Close()
+		return err
+	}
+	binary.LittleEndian.PutUint32(sizes[:], uint32(w.size))
+	if _, err := w.f.WriteAt(sizes[:], 40); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// liveInputRate is the sample rate of the audio input of the Live API.
+const liveInputRate = 16000
+
+// audioNormalizer converts the audio chunks sent by a client to 16-bit mono
+// PCM at 16 kHz, the input format of the Live API. It accepts audio/pcm with
+// the rate and channels parameters, e.g. "audio/pcm;rate=48000;channels=2",
+// and WAV files of 16-bit PCM. It keeps the state of the resampling between
+// the chunks of a stream.
+type audioNormalizer struct {
+	rate, channels int
+	// partial is the end of the previous chunk, when it was not a whole frame
+	partial   []byte
+	resampler *resampler
+}
+
+// normalize replaces the data of blob with normalized PCM audio, if it is
+// audio. Other blobs are unchanged.
+func (n *audioNormalizer) normalize(blob *genai.Blob) error {
+	mediaType, params, err := mime.ParseMediaType(blob.MIMEType)
+	if err != nil || !strings.HasPrefix(mediaType, "audio/") {
+		return nil
+	}
+	var pcm []byte
+	var rate, channels int
+	switch mediaType {
+	case "audio/pcm":
+		pcm = blob.Data
+		rate = pcmRate(blob.MIMEType, defaultInputRate)
+		channels = 1
+		if c := params["channels"]; c != "" {
+			if channels, err = strconv.Atoi(c); err != nil || channels < 1 {
+				return fmt.Errorf("invalid channels %q", c)
+			}
+		}
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		if pcm, rate, channels, err = decodeWAV(blob.Data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported audio format %s", mediaType)
+	}
+
+	if rate != n.rate || channels != n.channels {
+		// New stream format: start over
+		n.rate, n.channels, n.partial = rate, channels, nil
+		n.resampler = newResampler(rate, liveInputRate)
+	}
+	frameSize := 2 * channels
+	if len(n.partial) > 0 {
+		pcm = append(n.partial, pcm...)
+	}
+	whole := len(pcm) / frameSize * frameSize
+	n.partial = append([]byte(nil), pcm[whole:]...)
+	samples := downmix(pcm[:whole], channels)
+	if rate != liveInputRate {
+		samples = n.resampler.process(samples)
+	}
+	blob.Data = encodePCM16(samples)
+	blob.MIMEType = fmt.Sprintf("audio/pcm;rate=%d", liveInputRate)
+	return nil
+}
+
+// downmix decodes 16-bit little-endian PCM frames, and averages their
+// channels.
+func downmix(pcm []byte, channels int) []float64 {
+	frameSize := 2 * channels
+	samples := make([]float64, len(pcm)/frameSize)
+	for i := range samples {
+		frame := pcm[i*frameSize:]
+		var sum float64
+		for c := range channels {
+			sum += float64(int16(binary.LittleEndian.Uint16(frame[2*c:])))
+		}
+		samples[i] = sum / float64(channels)
+	}
+	return samples
+}
+
+func encodePCM16(samples []float64) []byte {
+	pcm := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		v = math.Round(max(math.MinInt16, min(math.MaxInt16, v)))
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(v)))
+	}
+	return pcm
+}
+
+// decodeWAV returns the 16-bit PCM data of a WAV file, its sample rate and
+// its number of channels.
+func decodeWAV(data []byte) (pcm []byte, rate, channels int, err error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, 0, fmt.Errorf("not a WAV file")
+	}
+	foundFormat := false
+	for chunks := data[12:]; len(chunks) >= 8; {
+		id := string(chunks[0:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:8]))
+		body := chunks[8:]
+		if size > len(body) {
+			// Streamed WAV files may have a wrong data size
+			size = len(body)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, 0, fmt.Errorf("invalid WAV format chunk")
+			}
+			format := binary.LittleEndian.Uint16(body[0:])
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			rate = int(binary.LittleEndian.Uint32(body[4:]))
+			bits := binary.LittleEndian.Uint16(body[14:])
+			if format != 1 || bits != 16 {
+				return nil, 0, 0, fmt.Errorf("unsupported WAV encoding (format %d, %d bits): only 16-bit PCM is supported", format, bits)
+			}
+			if channels < 1 || rate <= 0 {
+				return nil, 0, 0, fmt.Errorf("invalid WAV format: %d channels, rate %d", channels, rate)
+			}
+			foundFormat = true
+		case "data":
+			if !foundFormat {
+				return nil, 0, 0, fmt.Errorf("WAV data before format")
+			}
+			return body[:size], rate, channels, nil
+		}
+		// Chunks are padded to an even size
+		next := 8 + size + size%2
+		if next > len(chunks) {
+			break
+		}
+		chunks = chunks[next:]
+	}
+	return nil, 0, 0, fmt.Errorf("no data in WAV file")
+}
+
+// resampler converts a stream of samples from one rate to another, with a
+// windowed sinc interpolation. When downsampling, the sinc is a low-pass
+// filter that removes the frequencies above the new Nyquist frequency,
+// which would otherwise alias.
+type resampler struct {
+	from, to int
+	// scale is the cutoff frequency, relative to the input Nyquist frequency
+	scale float64
+	// half is the half width of the filter, in input samples
+	half int
+
+	// in holds the input samples from index base, including the
+	// history needed by the filter.
+	in   []float64
+	base int64
+	// next is the index of the next output sample
+	next int64
+}
+
+// resamplerZeros is the number of zero crossings of the sinc on each side.
+const resamplerZeros = 16
+
+func newResampler(from, to int) *resampler {
+	scale := min(1, float64(to)/float64(from))
+	// A cutoff slightly below the Nyquist frequency, to leave room for
+	// the transition band of the filter
+	scale *= 0.95
+	return &resampler{
+		from:  from,
+		to:    to,
+		scale: scale,
+		half:  int(math.Ceil(resamplerZeros / scale)),
+	}
+}
+
+// process returns the output samples that can be computed with the input
+// received so far. The last few are returned with the next input.
+func (r *resampler) process(samples []float64) []float64 {
+	r.in = append(r.in, samples...)
+	end := r.base + int64(len(r.in))
+	var out []float64
+	for {
+		// Position of the output sample, in input samples
+		x := float64(r.next*int64(r.from)) / float64(r.to)
+		center := int64(math.Floor(x))
+		if center+int64(r.half) >= end {
+			break
+		}
+		var sum float64
+		for k := max(center-int64(r.half)+1, r.base); k <= center+int64(r.half); k++ {
+			d := x - float64(k)
+			sum += r.in[k-r.base] * r.kernel(d)
+		}
+		out = append(out, sum)
+		r.next++
+	}
+	// Drop the samples that the next outputs don't need
+	x := float64(r.next*int64(r.from)) / float64(r.to)
+	keep := int64(math.Floor(x)) - int64(r.half)
+	if keep > r.base {
+		r.in = append(r.in[:0], r.in[keep-r.base:]...)
+		r.base = keep
+	}
+	return out
+}
+
+// kernel is the low-pass filter at distance d from the output position:
+// a sinc, with a Blackman window.
+func (r *resampler) kernel(d float64) float64 {
+	t := d / float64(r.half)
+	if t <= -1 || t >= 1 {
+		return 0
+	}
+	window := 0.42 + 0.5*math.Cos(math.Pi*t) + 0.08*math.Cos(2*math.Pi*t)
+	return r.scale * sinc(r.scale*d) * window
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// pcm16 encodes interleaved samples as 16-bit little-endian PCM.
+func pcm16(samples ...int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	return data
+}
+
+func decodePCM16(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+	return samples
+}
+
+// makeWAV builds a WAV file. An odd-sized LIST chunk before the data tests
+// the padding of the chunks.
+func makeWAV(channels, rate, bits int, pcm []byte) []byte {
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("RIFF")
+	le(uint32(0)) // the size is not checked
+	b.WriteString("WAVE")
+	b.WriteString("fmt ")
+	le(uint32(16))
+	le(uint16(1))
+	le(uint16(channels))
+	le(uint32(rate))
+	le(uint32(rate * channels * bits / 8))
+	le(uint16(channels * bits / 8))
+	le(uint16(bits))
+	b.WriteString("LIST")
+	le(uint32(3))
+	b.WriteString("abc\x00")
+	b.WriteString("data")
+	le(uint32(len(pcm)))
+	b.Write(pcm)
+	return b.Bytes()
+}
+
+// normalizeChunks normalizes data split into chunks of the given sizes,
+// cycling through them, and returns the concatenated output.
+func normalizeChunks(t *testing.T, mimeType string, data []byte, sizes ...int) []byte {
+	t.Helper()
+	var n audioNormalizer
+	var out []byte
+	for i := 0; len(data) > 0; i++ {
+		size := min(sizes[i%len(sizes)], len(data))
+		blob := &genai.Blob{MIMEType: mimeType, Data: data[:size]}
+		data = data[size:]
+		if err := n.normalize(blob); err != nil {
+			t.Fatal(err)
+		}
+		if blob.MIMEType != "audio/pcm;rate=16000" {
+			t.Fatalf("MIME type %q, want audio/pcm;rate=16000", blob.MIMEType)
+		}
+		out = append(out, blob.Data...)
+	}
+	return out
+}
+
+func TestNormalizePassThrough(t *testing.T) {
+	data := pcm16(1, -2, 300, -32768, 32767)
+	for _, mimeType := range []string{"audio/pcm", "audio/pcm;rate=16000"} {
+		out := normalizeChunks(t, mimeType, data, 3, 1, 5)
+		if !bytes.Equal(out, data) {
+			t.Errorf("%s: got %v, want %v unchanged", mimeType, decodePCM16(out), decodePCM16(data))
+		}
+	}
+}
+
+func TestNormalizeStereoDownmix(t *testing.T) {
+	data := pcm16(1000, 3000, 1000, -1000, -32768, -32768)
+	out := decodePCM16(normalizeChunks(t, "audio/pcm;rate=16000;channels=2", data, 3, 1, 7))
+	want := []int16{2000, 0, -32768}
+	if !slices.Equal(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+}
+
+// TestNormalizeResample resamples a 48 kHz stereo sine, in odd chunks that
+// split the frames, and checks that the output is the same as in one chunk,
+// with the same amplitude.
+func TestNormalizeResample(t *testing.T) {
+	const (
+		rate      = 48000
+		frequency = 440
+		amplitude = 10000
+	)
+	var samples []int16
+	for i := range rate / 2 {
+		v := int16(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/rate))
+		samples = append(samples, v, v)
+	}
+	data := pcm16(samples...)
+	const mimeType = "audio/pcm;rate=48000;channels=2"
+
+	whole := normalizeChunks(t, mimeType, data, len(data))
+	chunked := normalizeChunks(t, mimeType, data, 1, 3, 1001, 4097)
+	if !bytes.Equal(whole, chunked) {
+		t.Error("the output in chunks differs from the output in one chunk")
+	}
+
+	out := decodePCM16(whole)
+	// The filter holds back a few samples at the end
+	if want := rate / 2 / 3; len(out) > want || len(out) < want-resamplerZeros*4 {
+		t.Errorf("%d output samples, want about %d", len(out), want)
+	}
+	var peak int16
+	for _, v := range out[100:] {
+		peak = max(peak, v)
+	}
+	if math.Abs(float64(peak)-amplitude) > amplitude/100 {
+		t.Errorf("peak %d, want about %d", peak, amplitude)
+	}
+}
+
+func TestNormalizeWAV(t *testing.T) {
+	wav := makeWAV(2, 16000, 16, pcm16(100, 300, -100, -300))
+	blob := &genai.Blob{MIMEType: "audio/wav", Data: wav}
+	var n audioNormalizer
+	if err := n.normalize(blob); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decodePCM16(blob.Data), []int16{200, -200}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeOtherBlobs(t *testing.T) {
+	var n audioNormalizer
+	image := &genai.Blob{MIMEType: "image/jpeg", Data: []byte{1, 2, 3}}
+	if err := n.normalize(image); err != nil || image.MIMEType != "image/jpeg" || len(image.Data) != 3 {
+		t.Errorf("image blob changed: %v, %v", image, err)
+	}
+	for _, mimeType := range []string{"audio/mpeg", "audio/pcm;channels=0"} {
+		if err := n.normalize(&genai.Blob{MIMEType: mimeType, Data: []byte{1, 2}}); err == nil {
+			t.Errorf("%s: no error", mimeType)
+		}
+	}
+}
+
+func TestDecodeWAV(t *testing.T) {
+	pcm := pcm16(1, 2, 3, 4, 5, 6)
+	got, rate, channels, err := decodeWAV(makeWAV(2, 44100, 16, pcm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, pcm) || rate != 44100 || channels != 2 {
+		t.Errorf("got %v, rate %d, %d channels, want %v, rate 44100, 2 channels", got, rate, channels, pcm)
+	}
+
+	// A streamed WAV file may be shorter than its data size
+	truncated := makeWAV(1, 8000, 16, pcm)
+	truncated = truncated[:len(truncated)-3]
+	if got, _, _, err := decodeWAV(truncated); err != nil || len(got) != len(pcm)-3 {
+		t.Errorf("truncated: got %d bytes, %v, want %d bytes", len(got), err, len(pcm)-3)
+	}
+
+	for name, data := range map[string][]byte{
+		"8 bits":    makeWAV(1, 8000, 8, []byte{1, 2}),
+		"not WAV":   []byte("RIFF\x00\x00\x00\x00AVI LIST"),
+		"too short": []byte("RIFF"),
+	} {
+		if _, _, _, err := decodeWAV(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// generation is the metadata of a generated image, saved as a JSON sidecar
+// file next to the image itself.
+type generation struct {
+	Time              time.Time                   `json:"time"`
+	Image             string                      `json:"image"`
+	Index             int                         `json:"index"`
+	Prompt            string                      `json:"prompt"`
+	EnhancedPrompt    string                      `json:"enhancedPrompt,omitempty"`
+	Model             string                      `json:"model"`
+	Config            *genai.GenerateImagesConfig `json:"config,omitempty"`
+	Seed              *int32                      `json:"seed,omitempty"`
+	RAIFilteredReason string                      `json:"raiFilteredReason,omitempty"`
+	Backend           string                      `json:"backend"`
+	// Upscaled is the file name of the upscaled version of the image, if any.
+	Upscaled string `json:"upscaled,omitempty"`
+}
+
+// imageOutputs saves generated images and their metadata into a directory,
+// without overwriting the images of previous runs.
+type imageOutputs struct {
+	dir string
+}
+
+func newImageOutputs(dir string) (*imageOutputs, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &imageOutputs{dir: dir}, nil
+}
+
+// save writes the image and its JSON sidecar, and returns the path of the image.
+// The file name is built from the time of the generation in milliseconds, the
+// prompt, and the index of the image in the response. If two generations
+// still get the same name, e.g. concurrent gallery users, the second one gets
+// a suffix: the existing image is never overwritten.
+func (o *imageOutputs) save(img *genai.Image, meta generation) (string, error) {
+	base := fmt.Sprintf("%s_%s_%d", timestamp(meta.Time), slug(meta.Prompt), meta.Index)
+	name, err := writeUniqueFile(o.dir, base, extensionOf(img.MIMEType), img.ImageBytes)
+	if err != nil {
+		return "", err
+	}
+	meta.Image = name
+	if err := o.update(meta); err != nil {
+		return "", err
+	}
+	return filepath.Join(o.dir, name), nil
+}
+
+// timestamp formats t with millisecond precision, for the output file names.
+func timestamp(t time.Time) string {
+	return fmt.Sprintf("%s-%03d", t.Format("20060102-150405"), t.Nanosecond()/1e6)
+}
+
+// writeUniqueFile writes data into the new file base+ext in dir, and returns
+// its name. If the file already exists, it tries base-2+ext, base-3+ext...
+// An existing file is never overwritten.
+func writeUniqueFile(dir, base, ext string, data []byte) (string, error) {
+	for n := 1; ; n++ {
+		name := base + ext
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+		err := writeNewFile(filepath.Join(dir, name), data)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// writeNewFile is like os.WriteFile, but fails if the file already exists.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// update (re)writes the JSON sidecar of the image meta.Image.
+func (o *imageOutputs) update(meta generation) error {
+	sidecar, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(o.sidecarPath(meta.Image), sidecar, 0644)
+}
+
+// load returns the metadata of the image previously saved as file name image.
+func (o *imageOutputs) load(image string) (generation, error) {
+	var gen generation
+	data, err := os.ReadFile(o.sidecarPath(image))
+	if err != nil {
+		return gen, err
+	}
+	err = json.Unmarshal(data, &gen)
+	return gen, err
+}
+
+// saveUpscaled writes the upscaled version of the image gen.Image, and
+// records it in the sidecar. It returns the path of the upscaled image.
+func (o *imageOutputs) saveUpscaled(gen generation, data []byte, factor string) (string, error) {
+	base := strings.TrimSuffix(gen.Image, filepath.Ext(gen.Image)) + "_" + factor
+	name, err := writeUniqueFile(o.dir, base, ".jpg", data)
+	if err != nil {
+		return "", err
+	}
+	gen.Upscaled = name
+	if err := o.update(gen); err != nil {
+		return "", err
+	}
+	return filepath.Join(o.dir, name), nil
+}
+
+func (o *imageOutputs) sidecarPath(image string) string {
+	// filepath.Base prevents escaping the output directory
+	image = filepath.Base(image)
+	return filepath.Join(o.dir, strings.TrimSuffix(image, filepath.Ext(image))+".json")
+}
+
+// list returns the metadata of all the images previously saved, oldest first.
+func (o *imageOutputs) list() ([]generation, error) {
+	sidecars, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var gens []generation
+	for _, path := range sidecars {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var gen generation
+		if err := json.Unmarshal(data, &gen); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		gens = append(gens, gen)
+	}
+	slices.SortStableFunc(gens, func(a, b generation) int {
+		return a.Time.Compare(b.Time)
+	})
+	return gens, nil
+}
+
+// printGenerations prints one line per past generation.
+func printGenerations(gens []generation) {
+	if len(gens) == 0 {
+		fmt.Println("No generated images yet")
+		return
+	}
+	for _, gen := range gens {
+		fmt.Printf("%s  %-50s  %-24s  %q\n", gen.Time.Format(time.DateTime), gen.Image, gen.Model, gen.Prompt)
+	}
+}
+
+// slug turns a prompt into a short string usable in a file name,
+// e.g. "Create an overly decorated umbrella." => "create-an-overly-decorated-umbrella"
+func slug(prompt string) string {
+	const maxLength = 40
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(prompt) {
+		if sb.Len() >= maxLength {
+			break
+		}
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			if dash && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if sb.Len() == 0 {
+		return "image"
+	}
+	return sb.String()
+}
+
+// extensionOf returns the file extension for an image MIME type.
+func extensionOf(mimeType string) string {
+	switch mimeType {
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
+}
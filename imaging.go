@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/bits"
+	"os"
+
+	// Register the decoders of the formats found in testdata, and returned by the models
+	_ "image/gif"
+	_ "image/jpeg"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// decodeImage decodes PNG, JPEG or GIF image data into an image that we can draw on.
+func decodeImage(data []byte) (*image.RGBA, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	return dst, nil
+}
+
+// writePNG encodes img as PNG into the file path.
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// encodePNG returns the PNG encoding of img.
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// drawRect draws the outline of r, with the given line thickness.
+func drawRect(dst draw.Image, r image.Rectangle, c color.Color, thickness int) {
+	u := image.NewUniform(c)
+	for _, side := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness),
+		image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y),
+		image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(dst, side.Intersect(r), u, image.Point{}, draw.Src)
+	}
+}
+
+// drawLabel writes text in white over a small colored banner, whose
+// top-left corner is at pt.
+func drawLabel(dst draw.Image, pt image.Point, text string, background color.Color) {
+	face := basicfont.Face7x13
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.White,
+		Face: face,
+	}
+	width := d.MeasureString(text).Ceil()
+	height := face.Metrics().Height.Ceil()
+	banner := image.Rect(pt.X, pt.Y, pt.X+width+4, pt.Y+height+2)
+	draw.Draw(dst, banner, image.NewUniform(background), image.Point{}, draw.Src)
+	d.Dot = fixed.P(pt.X+2, pt.Y+face.Metrics().Ascent.Ceil()+1)
+	d.DrawString(text)
+}
+
+// compareImageFiles tells if two image files are byte-for-byte identical,
+// and otherwise how different they look.
+func compareImageFiles(path1, path2 string) (string, error) {
+	data1, err := os.ReadFile(path1)
+	if err != nil {
+		return "", err
+	}
+	data2, err := os.ReadFile(path2)
+	if err != nil {
+		return "", err
+	}
+	if sha256.Sum256(data1) == sha256.Sum256(data2) {
+		return "identical", nil
+	}
+	img1, err := decodeImage(data1)
+	if err != nil {
+		return "", err
+	}
+	img2, err := decodeImage(data2)
+	if err != nil {
+		return "", err
+	}
+	distance := bits.OnesCount64(perceptualHash(img1) ^ perceptualHash(img2))
+	return fmt.Sprintf("different bytes, perceptual hash distance %d/64", distance), nil
+}
+
+// perceptualHash is a difference hash (dHash): similar looking images have
+// hashes differing by only a few bits, even after resizing or re-encoding.
+func perceptualHash(img image.Image) uint64 {
+	// Shrink to 9x8 gray pixels, and compare each pixel with its right neighbor
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y < small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// palette is a list of easily distinguishable colors, to tell apart
+// several boxes drawn in the same image.
+var palette = []color.RGBA{
+	{R: 230, G: 25, B: 75, A: 255},
+	{R: 60, G: 180, B: 75, A: 255},
+	{R: 0, G: 130, B: 200, A: 255},
+	{R: 245, G: 130, B: 48, A: 255},
+	{R: 145, G: 30, B: 180, A: 255},
+	{R: 70, G: 240, B: 240, A: 255},
+	{R: 240, G: 50, B: 230, A: 255},
+	{R: 210, G: 245, B: 60, A: 255},
+}
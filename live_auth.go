@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	allowedOrigins = flag.String("allowed-origins", "", "samples 7, 8: comma-separated origins allowed to open a live WebSocket, in addition to the same origin, or * for any origin")
+	liveTokenFlag  = flag.String("live-token", "", "samples 7, 8: secret token required to open a live WebSocket (default: the LIVE_TOKEN env var, or no authentication)")
+	tlsCert        = flag.String("tls-cert", "", "samples 7, 8: TLS certificate file, to serve HTTPS and wss://")
+	tlsKey         = flag.String("tls-key", "", "samples 7, 8: TLS key file, to serve HTTPS and wss://")
+)
+
+const (
+	// liveSubprotocol is the WebSocket subprotocol selected by the server.
+	liveSubprotocol = "live"
+	// bearerPrefix is the prefix of the subprotocol carrying the token,
+	// for the clients that can't use the cookie, e.g.
+	//
+	//	new WebSocket(url, ['live', 'bearer.' + token])
+	bearerPrefix = "bearer."
+
+	authCookie         = "live_auth"
+	authCookieLifetime = 24 * time.Hour
+)
+
+// liveUpgrader returns the WebSocket upgrader of the live endpoints, which
+// checks the origin of the browser.
+func liveUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		CheckOrigin:  checkLiveOrigin,
+		Subprotocols: []string{liveSubprotocol},
+	}
+}
+
+// checkLiveOrigin accepts the requests from the same origin, from the
+// origins of -allowed-origins, and from the non-browser clients, which
+// don't send an Origin header.
+func checkLiveOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	var allowed []string
+	for _, o := range strings.Split(*allowedOrigins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed = append(allowed, o)
+		}
+	}
+	if slices.Contains(allowed, "*") || slices.Contains(allowed, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	log.Printf("origin %s not allowed", origin)
+	return false
+}
+
+// liveToken returns the secret token, or "" if no authentication is required.
+func liveToken() string {
+	if *liveTokenFlag != "" {
+		return *liveTokenFlag
+	}
+	return os.Getenv("LIVE_TOKEN")
+}
+
+// authorizeLive checks the signed cookie, or the bearer token of the
+// WebSocket subprotocols.
+func authorizeLive(r *http.Request) error {
+	token := liveToken()
+	if token == "" {
+		return nil
+	}
+	if c, err := r.Cookie(authCookie); err == nil && validAuthCookie(c.Value, token) {
+		return nil
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if bearer, ok := strings.CutPrefix(protocol, bearerPrefix); ok {
+			if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				return nil
+			}
+			return errors.New("invalid bearer token")
+		}
+	}
+	return errors.New("missing auth cookie or bearer token")
+}
+
+// loginForm is the page of /login. The token is posted in the body, so
+// that it doesn't end up in the access logs and the browser history.
+const loginForm = `<!DOCTYPE html>
+<title>Login</title>
+<form method="post" action="/login">
+  <label>Token <input type="password" name="token" autofocus></label>
+  <button type="submit">Login</button>
+</form>
+`
+
+// liveLogin shows the login form, and on POST sets the signed auth cookie
+// if the token is valid, and redirects to the home page. Open /login in the
+// browser once.
+func liveLogin(w http.ResponseWriter, r *http.Request) {
+	token := liveToken()
+	if token == "" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, loginForm)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Only the body: a token in the URL would be logged
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(token)) != 1 {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	expiry := time.Now().Add(authCookieLifetime)
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookie,
+		Value:    signAuthCookie(expiry, token),
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// signAuthCookie returns the cookie value "expiry.signature", where
+// signature is the HMAC of expiry with the token as key.
+func signAuthCookie(expiry time.Time, token string) string {
+	payload := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func validAuthCookie(value string, token string) bool {
+	payload, _, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiry := time.Unix(unix, 0)
+	if time.Now().After(expiry) {
+		return false
+	}
+	return hmac.Equal([]byte(value), []byte(signAuthCookie(expiry, token)))
+}
+
+// isSecure tells if the browser uses HTTPS, directly or through a proxy
+// terminating TLS.
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// liveWebSocketURL returns the URL of the /live endpoint, with the wss://
+// scheme when the page is served over HTTPS.
+func liveWebSocketURL(r *http.Request) string {
+	if isSecure(r) {
+		return "wss://" + r.Host + "/live"
+	}
+	return "ws://" + r.Host + "/live"
+}
+
+// checkTLSFlags returns an error if only one of -tls-cert, -tls-key is set.
+func checkTLSFlags() error {
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	return nil
+}
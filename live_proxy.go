@@ -0,0 +1,648 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/genai"
+)
+
+const (
+	// writeWait is the time allowed to write a message to the browser.
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong from the browser.
+	pongWait = 60 * time.Second
+	// pingPeriod is the interval of the pings to the browser. It must be
+	// shorter than pongWait.
+	pingPeriod = pongWait * 9 / 10
+)
+
+var drainTimeout = flag.Duration("drain-timeout", 10*time.Second, "samples 7, 8: on shutdown, max time to wait for the live sessions to end")
+
+// LiveProxy is an http.Handler that proxies the messages between a browser
+// WebSocket and a Gemini Live API session, one session per WebSocket.
+// Samples 7 and 8 are built on it.
+//
+// The hooks are optional. They let a live app add its own behavior without
+// forking the proxy. The hooks about server messages are called from the
+// goroutine receiving from the model, and OnClientMessage is called from the
+// goroutine reading from the browser, so they should not block for long.
+type LiveProxy struct {
+	// Upgrader upgrades the HTTP request to a WebSocket connection.
+	Upgrader websocket.Upgrader
+
+	// Config returns the configuration of a new live session with the
+	// model. It may read the setup chosen by the browser in the request.
+	Config func(r *http.Request, model string) (*genai.LiveConnectConfig, error)
+
+	// Model is the ID of the Live API model. If empty, liveModel is used.
+	Model string
+
+	// OnInputTranscript is called with each chunk of the transcription of the
+	// browser audio.
+	OnInputTranscript func(s *LiveSession, text string)
+
+	// OnOutputTranscript is called with each chunk of the transcription of the
+	// model audio.
+	OnOutputTranscript func(s *LiveSession, text string)
+
+	// OnServerMessage is called with each message from the model, before it
+	// is forwarded to the browser.
+	OnServerMessage func(s *LiveSession, message *genai.LiveServerMessage)
+
+	// OnClientMessage is called with each message from the browser, before it
+	// is sent to the model.
+	OnClientMessage func(s *LiveSession, input *genai.LiveRealtimeInput)
+
+	// OnTurnComplete is called when the model has finished its turn.
+	OnTurnComplete func(s *LiveSession)
+
+	// OnClose is called once, when the session is over. err is the error
+	// that ended the session, or nil if the browser closed it.
+	OnClose func(s *LiveSession, err error)
+
+	// Tools are the functions that the model can call. They run on the
+	// server, see live_tools.go.
+	Tools []LiveTool
+
+	// ToolTimeout is the max duration of a tool call. If zero, the
+	// default is 10s.
+	ToolTimeout time.Duration
+
+	// Client connects to the model, and determines the default model.
+	Client *genai.Client
+
+	// Dial, if set, connects to the model instead of Client, e.g. to a
+	// fake model in the tests.
+	Dial func(ctx context.Context, model string, config *genai.LiveConnectConfig) (liveUpstream, error)
+
+	// Authorize, if set, rejects the requests that are not authorized to
+	// open a live session, before the WebSocket upgrade.
+	Authorize func(r *http.Request) error
+
+	// RecordDir, if set, is the directory where each session is recorded,
+	// see live_recorder.go.
+	RecordDir string
+
+	// RecordRetention is the age of the recordings deleted when a new
+	// session starts. If zero, they are kept.
+	RecordRetention time.Duration
+
+	// ReplayPath, if set, is a recorded session replayed to each browser
+	// instead of calling the model, see live_replay.go.
+	ReplayPath string
+
+	// ReplaySpeed is the speed factor of the replay, or 0 for no delays.
+	ReplaySpeed float64
+
+	mu       sync.Mutex
+	sessions map[*LiveSession]struct{}
+	closing  bool
+	active   sync.WaitGroup
+}
+
+// LiveSession is the state of one proxied live session.
+type LiveSession struct {
+	// Request is the HTTP request that opened the browser WebSocket.
+	Request *http.Request
+	// Model is the ID of the Live API model.
+	Model string
+
+	// ctx is cancelled when either side closes, or when the server shuts down.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	conn    *liveConn
+	session liveUpstream
+	rec     *sessionRecorder
+	// audioIn normalizes the browser audio, in the read loop
+	audioIn audioNormalizer
+	// sendMu serializes the writes to session, which come from the
+	// browser input and from the tool calls.
+	sendMu sync.Mutex
+	// goroutines are all the goroutines of the session, including
+	// the tool calls.
+	goroutines sync.WaitGroup
+
+	mu               sync.Mutex
+	err              error
+	toolCalls        map[string]context.CancelFunc
+	inputTranscript  strings.Builder
+	outputTranscript strings.Builder
+}
+
+// Context returns the context of the session. It is derived from the
+// request, and cancelled when the session is over.
+func (s *LiveSession) Context() context.Context {
+	return s.ctx
+}
+
+// InputTranscript returns the transcription of the browser audio so far.
+func (s *LiveSession) InputTranscript() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inputTranscript.String()
+}
+
+// OutputTranscript returns the transcription of the model audio so far.
+func (s *LiveSession) OutputTranscript() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outputTranscript.String()
+}
+
+// fail ends the session with an error frame sent to the browser.
+// Only the first error is kept, for OnClose.
+func (s *LiveSession) fail(code int, err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	log.Println(err)
+	frame := errorFrame(err)
+	s.rec.proxy("error", frame)
+	s.conn.closeWithError(code, frame, err.Error())
+	s.cancel()
+}
+
+// applyFlags sets the client, the authorization, and the recording and
+// replay settings of p from the command line flags. Samples 7 and 8 call it
+// before serving.
+func (p *LiveProxy) applyFlags() {
+	p.Client = client
+	p.Authorize = authorizeLive
+	if *recordSessions {
+		p.RecordDir = *recordDir
+	}
+	p.RecordRetention = *recordRetention
+	p.ReplayPath = *replayPath
+	p.ReplaySpeed = *replaySpeed
+}
+
+// add registers a new request, unless the proxy is shutting down.
+func (p *LiveProxy) add() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		return false
+	}
+	p.active.Add(1)
+	return true
+}
+
+func (p *LiveProxy) track(s *LiveSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions == nil {
+		p.sessions = make(map[*LiveSession]struct{})
+	}
+	p.sessions[s] = struct{}{}
+}
+
+func (p *LiveProxy) untrack(s *LiveSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, s)
+}
+
+// Shutdown rejects the new sessions, sends a close frame to every active
+// browser WebSocket, closes their live sessions, and waits for them to end,
+// or for ctx to be done.
+//
+// The sessions are closed concurrently, without holding p.mu: a close can
+// block for a while on a slow browser, and ctx bounds the whole shutdown.
+func (p *LiveProxy) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closing = true
+	sessions := slices.Collect(maps.Keys(p.sessions))
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		go func() {
+			s.conn.close(websocket.CloseGoingAway, "server shutting down")
+			s.cancel()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serveLive runs an HTTP server with the handlers registered on
+// http.DefaultServeMux, until SIGINT or SIGTERM. It serves HTTPS when
+// -tls-cert and -tls-key are set. Then it stops accepting
+// connections, and closes the live sessions of proxy, waiting for them at
+// most -drain-timeout.
+func serveLive(ctx context.Context, proxy *LiveProxy) error {
+	if err := checkTLSFlags(); err != nil {
+		return err
+	}
+	if proxy.ReplaySpeed < 0 {
+		return fmt.Errorf("invalid -replay-speed %v, expected 0 or more", proxy.ReplaySpeed)
+	}
+	http.HandleFunc("/login", liveLogin)
+
+	// Determine port for HTTP service.
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+		log.Printf("defaulting to port %s", port)
+	}
+	srv := &http.Server{
+		Addr:        ":" + port,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start HTTP server.
+	log.Printf("listening on port %s", port)
+	serveErr := make(chan error, 1)
+	go func() {
+		if *tlsCert != "" {
+			serveErr <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-sigCtx.Done():
+	}
+	stop()
+
+	log.Printf("shutting down, waiting up to %v for the live sessions to end", *drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	// srv.Shutdown closes the listeners, but doesn't know about the hijacked
+	// WebSocket connections: those are closed by proxy.Shutdown.
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- srv.Shutdown(drainCtx)
+	}()
+	err := proxy.Shutdown(drainCtx)
+	err = errors.Join(err, <-shutdownErr)
+	if err := <-serveErr; err != http.ErrServerClosed {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	log.Println("shutdown complete")
+	return nil
+}
+
+func (p *LiveProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.add() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.active.Done()
+
+	if p.Authorize != nil {
+		if err := p.Authorize(r); err != nil {
+			log.Println("unauthorized live request:", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// Attempt to upgrade the HTTP connection to a WebSocket connection.
+	conn, err := p.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already replied with an HTTP error (e.g., invalid request headers).
+		log.Println("upgrade error: ", err)
+		return
+	}
+	s := &LiveSession{
+		Request: r,
+		Model:   p.Model,
+		conn:    &liveConn{Conn: conn},
+	}
+	s.ctx, s.cancel = context.WithCancel(r.Context())
+	defer s.cancel()
+	defer s.conn.Close()
+	p.track(s)
+	defer p.untrack(s)
+	if p.RecordDir != "" {
+		if s.rec, err = newSessionRecorder(p.RecordDir, p.RecordRetention); err != nil {
+			// The session works without its recording
+			log.Println("recorder error:", err)
+		}
+	}
+	defer func() {
+		s.mu.Lock()
+		err := s.err
+		s.mu.Unlock()
+		s.rec.close(s, err)
+		if p.OnClose != nil {
+			p.OnClose(s, err)
+		}
+	}()
+
+	if s.Model == "" && p.ReplayPath == "" && p.Client != nil {
+		s.Model = liveModel(p.Client.ClientConfig().Backend)
+	}
+	config := &genai.LiveConnectConfig{}
+	// A replayed session doesn't need a config
+	if p.Config != nil && p.ReplayPath == "" {
+		config, err = p.Config(r, s.Model)
+		if err != nil {
+			s.fail(websocket.ClosePolicyViolation, fmt.Errorf("session config error: %w", err))
+			return
+		}
+	}
+	if len(p.Tools) > 0 {
+		config.Tools = append(config.Tools, p.toolDeclarations())
+	}
+
+	s.session, err = p.connect(s, config)
+	if err != nil {
+		// Only this connection fails (e.g., network issues, invalid model name).
+		s.fail(websocket.CloseInternalServerErr, fmt.Errorf("connect to model error: %w", err))
+		return
+	}
+	defer s.session.Close() // Ensure session is closed when the handler exits
+
+	// The session goroutines all end when s.ctx is cancelled, and the
+	// handler waits for them, so that none of them leaks.
+	wg := &s.goroutines
+	defer wg.Wait()
+
+	// When either side closes, or on shutdown, close the other side as well:
+	// this unblocks the pending Receive and ReadMessage.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-s.ctx.Done()
+		s.session.Close()
+		s.conn.Close()
+	}()
+
+	// Goroutine to detect dead browsers
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.conn.keepAlive(s.ctx)
+	}()
+
+	// Goroutine to receive messages from the GenAI service and send to the client
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.receiveLoop(s)
+	}()
+
+	// Main loop to read messages from the client and send to the GenAI service
+	p.readLoop(s)
+}
+
+// connect establishes the live WebSocket connection with the model, which
+// resumes transparently when the connection drops, or with the recorded
+// session of p.ReplayPath.
+func (p *LiveProxy) connect(s *LiveSession, config *genai.LiveConnectConfig) (liveUpstream, error) {
+	if p.ReplayPath != "" {
+		log.Printf("replaying %s at speed %v", p.ReplayPath, p.ReplaySpeed)
+		replay, err := newReplaySession(p.ReplayPath, p.ReplaySpeed)
+		if err != nil {
+			return nil, err
+		}
+		replay.sendFrame = s.conn.writeText
+		return replay, nil
+	}
+	connect := p.Dial
+	if connect == nil {
+		if p.Client == nil {
+			return nil, errors.New("no client to connect to the model")
+		}
+		connect = func(ctx context.Context, model string, config *genai.LiveConnectConfig) (liveUpstream, error) {
+			session, err := p.Client.Live.Connect(ctx, model, config)
+			if err != nil {
+				return nil, err
+			}
+			return session, nil
+		}
+	}
+	return newResumableSession(s.ctx, withResumption(config, func(ctx context.Context, config *genai.LiveConnectConfig) (liveUpstream, error) {
+		return connect(ctx, s.Model, config)
+	}))
+}
+
+// receiveLoop forwards the messages of the model to the browser.
+func (p *LiveProxy) receiveLoop(s *LiveSession) {
+	defer s.cancel()
+	for {
+		// Receive the next message from the GenAI service session.
+		message, err := s.session.Receive()
+		if s.ctx.Err() != nil {
+			// The browser is gone, or the server is shutting down
+			return
+		}
+		if err != nil {
+			// The model session is over (e.g., connection closed, network error):
+			// tell the browser, and end this connection only.
+			s.fail(websocket.CloseInternalServerErr, fmt.Errorf("receive model response error: %w", err))
+			return
+		}
+		p.handleServerContent(s, message.ServerContent)
+		// A replayed session sends the recorded tool events instead of
+		// running the tools again.
+		if message.ToolCall != nil && p.ReplayPath == "" {
+			p.startToolCalls(s, message.ToolCall.FunctionCalls)
+		}
+		if message.ToolCallCancellation != nil && p.ReplayPath == "" {
+			p.cancelToolCalls(s, message.ToolCallCancellation.IDs)
+		}
+		if p.OnServerMessage != nil {
+			p.OnServerMessage(s, message)
+		}
+
+		// Marshal the received message into JSON format.
+		messageBytes, err := json.Marshal(message)
+		if err != nil {
+			s.fail(websocket.CloseInternalServerErr, fmt.Errorf("marshal model response error: %w", err))
+			return
+		}
+		s.rec.server(message, messageBytes)
+		// Send the JSON message to the client WebSocket.
+		if err := s.conn.writeText(messageBytes); err != nil {
+			// The client is gone (e.g., client disconnected), or too slow.
+			log.Println("write message error: ", err)
+			return
+		}
+
+		if sc := message.ServerContent; sc != nil && sc.TurnComplete && p.OnTurnComplete != nil {
+			p.OnTurnComplete(s)
+		}
+	}
+}
+
+// handleServerContent accumulates the transcripts, and calls the
+// transcript hooks.
+func (p *LiveProxy) handleServerContent(s *LiveSession, sc *genai.LiveServerContent) {
+	if sc == nil {
+		return
+	}
+	if t := sc.InputTranscription; t != nil && t.Text != "" {
+		s.mu.Lock()
+		s.inputTranscript.WriteString(t.Text)
+		s.mu.Unlock()
+		if p.OnInputTranscript != nil {
+			p.OnInputTranscript(s, t.Text)
+		}
+	}
+	if t := sc.OutputTranscription; t != nil && t.Text != "" {
+		s.mu.Lock()
+		s.outputTranscript.WriteString(t.Text)
+		s.mu.Unlock()
+		if p.OnOutputTranscript != nil {
+			p.OnOutputTranscript(s, t.Text)
+		}
+	}
+}
+
+// readLoop forwards the messages of the browser to the model, until the
+// browser WebSocket is closed.
+func (p *LiveProxy) readLoop(s *LiveSession) {
+	defer s.cancel()
+	// A browser that doesn't answer the pings is considered dead.
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		// Read the next message from the client WebSocket.
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			// The client is gone (e.g., client disconnected), or the
+			// connection was closed by the receive loop.
+			if s.ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				log.Println("read from client error: ", err)
+			}
+			return
+		}
+
+		var realtimeInput genai.LiveRealtimeInput
+		// Unmarshal the received client message into a LiveRealtimeInput struct.
+		if err := json.Unmarshal(message, &realtimeInput); err != nil {
+			// The browser sent a malformed message (e.g., invalid JSON format).
+			s.fail(websocket.CloseUnsupportedData, fmt.Errorf("unmarshal message error: %w", err))
+			return
+		}
+		// Whatever the client sends, the model gets 16 kHz mono PCM
+		for _, blob := range []*genai.Blob{realtimeInput.Media, realtimeInput.Audio} {
+			if blob == nil {
+				continue
+			}
+			if err := s.audioIn.normalize(blob); err != nil {
+				s.fail(websocket.CloseUnsupportedData, fmt.Errorf("audio input error: %w", err))
+				return
+			}
+		}
+		if p.OnClientMessage != nil {
+			p.OnClientMessage(s, &realtimeInput)
+		}
+		s.rec.client(&realtimeInput, len(message))
+		// Send the unmarshaled realtime input to the GenAI service session.
+		s.sendMu.Lock()
+		err = s.session.SendRealtimeInput(realtimeInput)
+		s.sendMu.Unlock()
+		if err != nil {
+			s.fail(websocket.CloseInternalServerErr, fmt.Errorf("send to model error: %w", err))
+			return
+		}
+	}
+}
+
+// liveConn is a browser WebSocket connection. It serializes the writes,
+// because a gorilla websocket.Conn supports only one concurrent writer.
+// All the writes have a deadline, so that a dead browser can't block the
+// session forever.
+type liveConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *liveConn) writeText(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// keepAlive pings the browser every pingPeriod, until ctx is done.
+// The pongs extend the read deadline, see LiveProxy.readLoop.
+func (c *liveConn) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			err := c.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			c.mu.Unlock()
+			if err != nil {
+				// The read deadline will end the session
+				return
+			}
+		}
+	}
+}
+
+// liveError is the structured error frame sent to the browser.
+type liveError struct {
+	Error string `json:"error"`
+}
+
+// close sends a close frame to the browser, and closes the WebSocket.
+func (c *liveConn) close(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The close reason is limited to 123 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.Close()
+}
+
+func errorFrame(err error) []byte {
+	frame, _ := json.Marshal(liveError{Error: err.Error()})
+	return frame
+}
+
+// closeWithError sends a structured error frame to the browser, and then
+// closes the WebSocket with the given close code. Other browser sessions
+// are not affected.
+func (c *liveConn) closeWithError(code int, frame []byte, reason string) {
+	c.writeText(frame)
+	c.close(code, reason)
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/genai"
+)
+
+// fakeUpstream is a fake model. The test sends the model messages to
+// messages, and the errors to errs. Receive blocks until one of them, or
+// until Close. The next SendRealtimeInput fails with the error sent to
+// sendErrs, if any.
+type fakeUpstream struct {
+	messages chan *genai.LiveServerMessage
+	errs     chan error
+	inputs   chan genai.LiveRealtimeInput
+	sendErrs chan error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newFakeUpstream() *fakeUpstream {
+	return &fakeUpstream{
+		messages: make(chan *genai.LiveServerMessage, 10),
+		errs:     make(chan error, 1),
+		inputs:   make(chan genai.LiveRealtimeInput, 10),
+		sendErrs: make(chan error, 1),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (f *fakeUpstream) Receive() (*genai.LiveServerMessage, error) {
+	select {
+	case m := <-f.messages:
+		return m, nil
+	case err := <-f.errs:
+		return nil, err
+	case <-f.closed:
+		return nil, errors.New("fake session closed")
+	}
+}
+
+func (f *fakeUpstream) SendRealtimeInput(input genai.LiveRealtimeInput) error {
+	select {
+	case err := <-f.sendErrs:
+		return err
+	default:
+	}
+	select {
+	case f.inputs <- input:
+		return nil
+	case <-f.closed:
+		return errors.New("fake session closed")
+	}
+}
+
+func (f *fakeUpstream) SendToolResponse(input genai.LiveToolResponseInput) error {
+	return nil
+}
+
+func (f *fakeUpstream) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+// liveTest is a LiveProxy with a fake model, behind a test server.
+type liveTest struct {
+	t        *testing.T
+	proxy    *LiveProxy
+	server   *httptest.Server
+	upstream *fakeUpstream
+	closeErr chan error
+}
+
+// startLiveTest starts the proxy, after applying the configure functions,
+// and checks at the end of the test that all the goroutines of the
+// sessions are gone.
+func startLiveTest(t *testing.T, configure ...func(p *LiveProxy)) *liveTest {
+	goroutines := runtime.NumGoroutine()
+	lt := &liveTest{
+		t:        t,
+		upstream: newFakeUpstream(),
+		closeErr: make(chan error, 1),
+	}
+	lt.proxy = &LiveProxy{
+		Model: "fake-model",
+		OnClose: func(s *LiveSession, err error) {
+			lt.closeErr <- err
+		},
+		Dial: func(context.Context, string, *genai.LiveConnectConfig) (liveUpstream, error) {
+			return lt.upstream, nil
+		},
+	}
+	for _, f := range configure {
+		f(lt.proxy)
+	}
+	lt.server = httptest.NewServer(lt.proxy)
+	t.Cleanup(func() {
+		lt.server.Close()
+		checkGoroutines(t, goroutines)
+	})
+	return lt
+}
+
+func (lt *liveTest) dial() *websocket.Conn {
+	lt.t.Helper()
+	url := "ws" + strings.TrimPrefix(lt.server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		lt.t.Fatal(err)
+	}
+	lt.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitClose waits for the end of the session, and returns its error.
+func (lt *liveTest) waitClose() error {
+	lt.t.Helper()
+	select {
+	case err := <-lt.closeErr:
+		return err
+	case <-time.After(5 * time.Second):
+		lt.t.Fatal("the session did not end")
+		return nil
+	}
+}
+
+// checkGoroutines fails if the number of goroutines doesn't go back to
+// want within a few seconds.
+func checkGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := runtime.NumGoroutine()
+		if got <= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Fatalf("%d goroutines leaked:\n%s", got-want, buf)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readUntilClose reads the messages of the browser WebSocket, and returns
+// the error frames and the close code.
+func readUntilClose(t *testing.T, conn *websocket.Conn) (errorFrames []string, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("expected a close frame, got %v", err)
+			}
+			return errorFrames, closeErr.Code
+		}
+		var frame liveError
+		if json.Unmarshal(data, &frame) == nil && frame.Error != "" {
+			errorFrames = append(errorFrames, frame.Error)
+		}
+	}
+}
+
+func TestLiveProxyBrowserClose(t *testing.T) {
+	lt := startLiveTest(t)
+	conn := lt.dial()
+
+	// Browser to model
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"text":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case input := <-lt.upstream.inputs:
+		if input.Text != "hello" {
+			t.Errorf("model got text %q, want %q", input.Text, "hello")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the model got no input")
+	}
+
+	// Model to browser
+	lt.upstream.messages <- &genai.LiveServerMessage{
+		ServerContent: &genai.LiveServerContent{TurnComplete: true},
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "turnComplete") {
+		t.Errorf("browser got %s, want a turnComplete", data)
+	}
+
+	conn.Close()
+	if err := lt.waitClose(); err != nil {
+		t.Errorf("OnClose error: %v, want nil when the browser closes", err)
+	}
+	select {
+	case <-lt.upstream.closed:
+	default:
+		t.Error("the model session is not closed")
+	}
+}
+
+func TestLiveProxyUpstreamError(t *testing.T) {
+	lt := startLiveTest(t)
+	conn := lt.dial()
+
+	lt.upstream.errs <- errors.New("connection reset")
+	errorFrames, code := readUntilClose(t, conn)
+	if code != websocket.CloseInternalServerErr {
+		t.Errorf("close code %d, want %d", code, websocket.CloseInternalServerErr)
+	}
+	if len(errorFrames) != 1 || !strings.Contains(errorFrames[0], "connection reset") {
+		t.Errorf("error frames %q, want the model error", errorFrames)
+	}
+	if err := lt.waitClose(); err == nil {
+		t.Error("OnClose error is nil, want the model error")
+	}
+}
+
+func TestLiveProxyMalformedFrame(t *testing.T) {
+	lt := startLiveTest(t)
+	conn := lt.dial()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{not json`)); err != nil {
+		t.Fatal(err)
+	}
+	errorFrames, code := readUntilClose(t, conn)
+	if code != websocket.CloseUnsupportedData {
+		t.Errorf("close code %d, want %d", code, websocket.CloseUnsupportedData)
+	}
+	if len(errorFrames) != 1 {
+		t.Errorf("error frames %q, want one", errorFrames)
+	}
+	if err := lt.waitClose(); err == nil {
+		t.Error("OnClose error is nil, want the unmarshal error")
+	}
+}
+
+func TestLiveProxyShutdown(t *testing.T) {
+	lt := startLiveTest(t)
+	conn := lt.dial()
+
+	// Wait for the session to be tracked, as Shutdown closes only those
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"text":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	<-lt.upstream.inputs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lt.proxy.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := readUntilClose(t, conn); code != websocket.CloseGoingAway {
+		t.Errorf("close code %d, want %d", code, websocket.CloseGoingAway)
+	}
+	lt.waitClose()
+
+	// New sessions are rejected
+	res, err := http.Get(lt.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status %d after shutdown, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestLiveProxyShutdownDeadline(t *testing.T) {
+	lt := startLiveTest(t)
+	conn := lt.dial()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"text":"hello"}`)); err != nil {
+		t.Fatal(err)
+	}
+	<-lt.upstream.inputs
+
+	// A write in progress to a slow browser holds the connection lock
+	lt.proxy.mu.Lock()
+	var stalled *LiveSession
+	for s := range lt.proxy.sessions {
+		stalled = s
+	}
+	lt.proxy.mu.Unlock()
+	stalled.conn.mu.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := lt.proxy.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %v, want it bounded by its context", elapsed)
+	}
+
+	stalled.conn.mu.Unlock()
+	lt.waitClose()
+}
+
+func TestLiveProxyUnauthorized(t *testing.T) {
+	lt := startLiveTest(t, func(p *LiveProxy) {
+		p.Authorize = func(r *http.Request) error {
+			return errors.New("no token")
+		}
+	})
+	url := "ws" + strings.TrimPrefix(lt.server.URL, "http")
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("dial succeeded, want an unauthorized error")
+	}
+	if res == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("response %v, want status %d", res, http.StatusUnauthorized)
+	}
+}
+
+// readFrames reads n messages of the browser WebSocket.
+func readFrames(t *testing.T, conn *websocket.Conn, n int) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frames []string
+	for range n {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("after %d frames: %v", len(frames), err)
+		}
+		frames = append(frames, string(data))
+	}
+	return frames
+}
+
+func TestLiveProxyReplayToolCalls(t *testing.T) {
+	calls := 0
+	pingTool := LiveTool{
+		Declaration: &genai.FunctionDeclaration{Name: "ping"},
+		Call: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			calls++
+			return map[string]any{"pong": true}, nil
+		},
+	}
+	recordDir := t.TempDir()
+
+	// Record a session with a tool call
+	lt := startLiveTest(t, func(p *LiveProxy) {
+		p.Tools = []LiveTool{pingTool}
+		p.RecordDir = recordDir
+	})
+	conn := lt.dial()
+	lt.upstream.messages <- &genai.LiveServerMessage{
+		ToolCall: &genai.LiveServerToolCall{
+			FunctionCalls: []*genai.FunctionCall{{ID: "call1", Name: "ping"}},
+		},
+	}
+	recorded := readFrames(t, conn, 3)
+	conn.Close()
+	lt.waitClose()
+	if calls != 1 {
+		t.Fatalf("%d tool calls while recording, want 1", calls)
+	}
+
+	// Replay it: the tool must not run again, and the browser gets the
+	// same frames
+	sessions, err := filepath.Glob(filepath.Join(recordDir, "*"))
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("recorded sessions %v, %v", sessions, err)
+	}
+	lt = startLiveTest(t, func(p *LiveProxy) {
+		p.Tools = []LiveTool{pingTool}
+		p.ReplayPath = sessions[0]
+		p.ReplaySpeed = 0
+	})
+	conn = lt.dial()
+	replayed := readFrames(t, conn, 3)
+	conn.Close()
+	lt.waitClose()
+	if calls != 1 {
+		t.Errorf("%d tool calls after replay, want 1", calls)
+	}
+	slices.Sort(recorded)
+	slices.Sort(replayed)
+	if !slices.Equal(recorded, replayed) {
+		t.Errorf("replayed frames:\n%q\nwant the recorded frames:\n%q", replayed, recorded)
+	}
+}
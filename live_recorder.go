@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+var (
+	recordSessions  = flag.Bool("record", false, "samples 7, 8: record each live session in a directory of -record-dir")
+	recordDir       = flag.String("record-dir", "live_sessions", "samples 7, 8: directory of the live session recordings")
+	recordRetention = flag.Duration("record-retention", 7*24*time.Hour, "samples 7, 8: delete the recordings older than this (0 to keep them all)")
+)
+
+// liveEvent is a line of the JSONL event log of a recorded session.
+type liveEvent struct {
+	Time time.Time `json:"time"`
+	// Direction is "client" for the browser messages, "server" for the model
+	// messages, "proxy" for the frames sent to the browser by the proxy
+	// itself, or "session" for the end of the session.
+	Direction string `json:"direction"`
+	// Type is the kind of message, e.g. "audio", "video", "serverContent",
+	// "toolEvent", "error".
+	Type string `json:"type"`
+	// Size is the size of the JSON message, in bytes.
+	Size int `json:"size"`
+	// Message is the LiveServerMessage for the server messages, or the
+	// frame for the proxy messages. The client media are in the WAV and
+	// frame files.
+	Message json.RawMessage `json:"message,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// sessionRecorder writes everything that happens in a live session to its
+// own directory:
+//
+//	events.jsonl      one liveEvent per message
+//	input.wav         the browser audio, as sent to the model
+//	output.wav        the model audio
+//	frames/           the video frames sent by the browser
+//	transcript.txt    the final transcripts
+//
+// A nil *sessionRecorder records nothing.
+type sessionRecorder struct {
+	dir string
+
+	mu     sync.Mutex
+	events *os.File
+	input  *wavWriter
+	output *wavWriter
+	frames int
+}
+
+// newSessionRecorder creates a new session directory in parent, after
+// deleting the recordings older than retention.
+func newSessionRecorder(parent string, retention time.Duration) (*sessionRecorder, error) {
+	if err := pruneRecordings(parent, retention); err != nil {
+		log.Println("pruning recordings:", err)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, time.Now().Format(recordingTimeFormat)+"_")
+	if err != nil {
+		return nil, err
+	}
+	openRecordings.add(dir)
+	events, err := os.Create(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		openRecordings.remove(dir)
+		return nil, err
+	}
+	return &sessionRecorder{dir: dir, events: events}, nil
+}
+
+// recordingTimeFormat is the prefix of the session directory names, followed
+// by "_" and a random suffix.
+const recordingTimeFormat = "20060102-150405"
+
+// openRecordings are the directories of the sessions being recorded. They
+// are never pruned, even if the session has been idle for long.
+var openRecordings = recordingSet{dirs: make(map[string]bool)}
+
+type recordingSet struct {
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+func (rs *recordingSet) add(dir string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.dirs[filepath.Clean(dir)] = true
+}
+
+func (rs *recordingSet) remove(dir string) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	delete(rs.dirs, filepath.Clean(dir))
+}
+
+func (rs *recordingSet) contains(dir string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.dirs[filepath.Clean(dir)]
+}
+
+// pruneRecordings deletes the session recordings whose last event is older
+// than retention. Only the directories created by newSessionRecorder are
+// considered, i.e. named after recordingTimeFormat and containing an
+// events.jsonl file, so that a -record-dir shared with other files is safe.
+// The sessions still being recorded are kept.
+func pruneRecordings(parent string, retention time.Duration) error {
+	if retention <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(parent)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isRecordingName(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(parent, entry.Name())
+		if openRecordings.contains(dir) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, "events.jsonl"))
+		if os.IsNotExist(err) {
+			// Not a recording
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) > retention {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isRecordingName tells if name looks like a session directory created by
+// newSessionRecorder, e.g. 20261019-101500_123456789.
+func isRecordingName(name string) bool {
+	stamp, suffix, ok := strings.Cut(name, "_")
+	if !ok || suffix == "" {
+		return false
+	}
+	_, err := time.Parse(recordingTimeFormat, stamp)
+	return err == nil
+}
+
+func (r *sessionRecorder) log(e liveEvent) {
+	e.Time = time.Now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Println("recording event:", err)
+		return
+	}
+	r.events.Write(append(line, '\n'))
+}
+
+// client records a message from the browser.
+func (r *sessionRecorder) client(input *genai.LiveRealtimeInput, size int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log(liveEvent{Direction: "client", Type: clientMessageType(input), Size: size})
+	for _, blob := range []*genai.Blob{input.Media, input.Audio, input.Video} {
+		if blob == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(blob.MIMEType, "audio/pcm"):
+			r.appendAudio(&r.input, "input.wav", blob, defaultInputRate)
+		case strings.HasPrefix(blob.MIMEType, "image/"):
+			r.frames++
+			name := fmt.Sprintf("frame_%06d%s", r.frames, extensionOf(blob.MIMEType))
+			if err := os.MkdirAll(filepath.Join(r.dir, "frames"), 0755); err != nil {
+				log.Println("recording frame:", err)
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(r.dir, "frames", name), blob.Data, 0644); err != nil {
+				log.Println("recording frame:", err)
+			}
+		}
+	}
+}
+
+// server records a message from the model, and its JSON encoding.
+func (r *sessionRecorder) server(message *genai.LiveServerMessage, data []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log(liveEvent{Direction: "server", Type: serverMessageType(message), Size: len(data), Message: data})
+	if sc := message.ServerContent; sc != nil && sc.ModelTurn != nil {
+		for _, part := range sc.ModelTurn.Parts {
+			if part.InlineData != nil && strings.HasPrefix(part.InlineData.MIMEType, "audio/pcm") {
+				// The Live API audio output is at 24 kHz
+				r.appendAudio(&r.output, "output.wav", part.InlineData, 24000)
+			}
+		}
+	}
+}
+
+// proxy records a frame sent to the browser by the proxy itself: a tool
+// event, or an error.
+func (r *sessionRecorder) proxy(typ string, frame []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log(liveEvent{Direction: "proxy", Type: typ, Size: len(frame), Message: frame})
+}
+
+// appendAudio appends a PCM chunk to the WAV file *w, which is created
+// with the rate of the first chunk.
+func (r *sessionRecorder) appendAudio(w **wavWriter, name string, blob *genai.Blob, defaultRate int) {
+	if *w == nil {
+		var err error
+		*w, err = createWAV(filepath.Join(r.dir, name), pcmRate(blob.MIMEType, defaultRate))
+		if err != nil {
+			log.Println("recording audio:", err)
+			return
+		}
+	}
+	if _, err := (*w).Write(blob.Data); err != nil {
+		log.Println("recording audio:", err)
+	}
+}
+
+// close records the end of the session and its transcripts, and closes
+// the files.
+func (r *sessionRecorder) close(s *LiveSession, sessionErr error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := liveEvent{Direction: "session", Type: "close"}
+	if sessionErr != nil {
+		e.Error = sessionErr.Error()
+	}
+	r.log(e)
+	transcript := fmt.Sprintf("Input:\n%s\n\nOutput:\n%s\n", s.InputTranscript(), s.OutputTranscript())
+	if err := os.WriteFile(filepath.Join(r.dir, "transcript.txt"), []byte(transcript), 0644); err != nil {
+		log.Println("recording transcript:", err)
+	}
+	for _, w := range []*wavWriter{r.input, r.output} {
+		if w != nil {
+			if err := w.Close(); err != nil {
+				log.Println("recording audio:", err)
+			}
+		}
+	}
+	if err := r.events.Close(); err != nil {
+		log.Println("recording events:", err)
+	}
+	openRecordings.remove(r.dir)
+	log.Println("recorded session in", r.dir)
+}
+
+func clientMessageType(input *genai.LiveRealtimeInput) string {
+	for _, blob := range []*genai.Blob{input.Media, input.Audio, input.Video} {
+		if blob != nil {
+			if strings.HasPrefix(blob.MIMEType, "image/") {
+				return "video"
+			}
+			return "audio"
+		}
+	}
+	switch {
+	case input.Text != "":
+		return "text"
+	case input.AudioStreamEnd:
+		return "audioStreamEnd"
+	case input.ActivityStart != nil:
+		return "activityStart"
+	case input.ActivityEnd != nil:
+		return "activityEnd"
+	}
+	return "unknown"
+}
+
+func serverMessageType(message *genai.LiveServerMessage) string {
+	switch {
+	case message.SetupComplete != nil:
+		return "setupComplete"
+	case message.ServerContent != nil:
+		return "serverContent"
+	case message.ToolCall != nil:
+		return "toolCall"
+	case message.ToolCallCancellation != nil:
+		return "toolCallCancellation"
+	case message.GoAway != nil:
+		return "goAway"
+	case message.SessionResumptionUpdate != nil:
+		return "sessionResumptionUpdate"
+	case message.UsageMetadata != nil:
+		return "usageMetadata"
+	}
+	return "unknown"
+}
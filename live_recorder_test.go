@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneRecordings(t *testing.T) {
+	parent := t.TempDir()
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	// mkdir creates a directory in parent, with the given files, all
+	// modified at mtime.
+	mkdir := func(name string, mtime time.Time, files ...string) string {
+		t.Helper()
+		dir := filepath.Join(parent, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range append(files, ".") {
+			path := filepath.Join(dir, f)
+			if f != "." {
+				if err := os.WriteFile(path, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+	expired := mkdir("20200101-000000_1", old, "events.jsonl", "input.wav")
+	recent := mkdir("20200101-000000_2", time.Now(), "events.jsonl")
+	foreign := mkdir("holiday_photos", old, "events.jsonl")
+	noEvents := mkdir("20200101-000000_3", old, "notes.txt")
+	// A long session: its directory is old, but its last event is recent
+	longSession := mkdir("20200101-000000_4", old)
+	if err := os.WriteFile(filepath.Join(longSession, "events.jsonl"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A session still being recorded, idle for long
+	rec, err := newSessionRecorder(parent, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(rec.dir, "events.jsonl"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneRecordings(parent, 7*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	exists := func(dir string) bool {
+		_, err := os.Stat(dir)
+		return err == nil
+	}
+	if exists(expired) {
+		t.Errorf("%s: expired recording not pruned", expired)
+	}
+	for _, dir := range []string{recent, foreign, noEvents, longSession, rec.dir} {
+		if !exists(dir) {
+			t.Errorf("%s: pruned, want it kept", dir)
+		}
+	}
+
+	// Once closed, the idle session can be pruned
+	rec.close(&LiveSession{}, nil)
+	if err := os.Chtimes(filepath.Join(rec.dir, "events.jsonl"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneRecordings(parent, 7*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if exists(rec.dir) {
+		t.Errorf("%s: closed expired recording not pruned", rec.dir)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+var (
+	replayPath  = flag.String("replay", "", "samples 7, 8: replay a recorded live session (a directory of -record-dir, or its events.jsonl) instead of calling the model")
+	replaySpeed = flag.Float64("replay-speed", 1, "samples 7, 8: speed factor of -replay, e.g. 2 for twice as fast, or 0 for no delays")
+)
+
+// liveUpstream is the model side of a proxied live session.
+// It is implemented by *genai.Session, *resumableSession and *replaySession.
+type liveUpstream interface {
+	Receive() (*genai.LiveServerMessage, error)
+	SendRealtimeInput(input genai.LiveRealtimeInput) error
+	SendToolResponse(input genai.LiveToolResponseInput) error
+	Close() error
+}
+
+// replaySession sends the server messages of a recorded session, with
+// their original timing divided by speed. It ignores the browser input.
+// After the last message, it waits for the session to be closed.
+//
+// The frames sent by the proxy itself, i.e. the tool events and errors, are
+// replayed with sendFrame, so that the tools don't run again.
+type replaySession struct {
+	events    []replayEvent
+	speed     float64
+	start     time.Time
+	next      int
+	sendFrame func([]byte) error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// replayEvent is a recorded server message or proxy frame, with its time
+// relative to the beginning of the recording.
+type replayEvent struct {
+	offset  time.Duration
+	message json.RawMessage
+	// frame tells if message is a proxy frame, sent as is to the browser.
+	frame bool
+}
+
+// newReplaySession loads the server messages of the recording at path.
+func newReplaySession(path string, speed float64) (*replaySession, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("invalid replay speed %v", speed)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "events.jsonl")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &replaySession{
+		speed:  speed,
+		start:  time.Now(),
+		closed: make(chan struct{}),
+	}
+	var first time.Time
+	scanner := bufio.NewScanner(f)
+	// The server messages with audio can be large
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e liveEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if first.IsZero() {
+			first = e.Time
+		}
+		if (e.Direction != "server" && e.Direction != "proxy") || len(e.Message) == 0 {
+			continue
+		}
+		r.events = append(r.events, replayEvent{
+			offset:  e.Time.Sub(first),
+			message: e.Message,
+			frame:   e.Direction == "proxy",
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *replaySession) Receive() (*genai.LiveServerMessage, error) {
+	for {
+		if r.next >= len(r.events) {
+			<-r.closed
+			return nil, fmt.Errorf("replay session closed")
+		}
+		e := r.events[r.next]
+		r.next++
+		if r.speed > 0 {
+			offset := time.Duration(float64(e.offset) / r.speed)
+			select {
+			case <-time.After(time.Until(r.start.Add(offset))):
+			case <-r.closed:
+				return nil, fmt.Errorf("replay session closed")
+			}
+		}
+		if e.frame {
+			if r.sendFrame != nil {
+				if err := r.sendFrame(e.message); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		message := new(genai.LiveServerMessage)
+		if err := json.Unmarshal(e.message, message); err != nil {
+			return nil, err
+		}
+		return message, nil
+	}
+}
+
+func (r *replaySession) SendRealtimeInput(input genai.LiveRealtimeInput) error {
+	return nil
+}
+
+func (r *replaySession) SendToolResponse(input genai.LiveToolResponseInput) error {
+	return nil
+}
+
+func (r *replaySession) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// maxBufferedInputs is the max number of browser messages kept while
+// reconnecting to the model. The oldest are dropped beyond this.
+const maxBufferedInputs = 500
+
+const (
+	// maxResumeAttempts is the max number of consecutive attempts to resume
+	// a session, without any message from the model in between.
+	maxResumeAttempts = 5
+	// resumeBackoff is the delay before the second attempt. It doubles
+	// at each attempt.
+	resumeBackoff = time.Second
+)
+
+// resumableSession is a Live API session that transparently reconnects to
+// the model, with the latest session resumption handle, when the model
+// sends a GoAway or when the connection drops. The browser WebSocket stays
+// open meanwhile, and the browser input is buffered during the switch.
+type resumableSession struct {
+	ctx context.Context
+	// dial connects a new session, resuming the session of handle if not empty.
+	dial    func(ctx context.Context, handle string) (liveUpstream, error)
+	backoff time.Duration
+
+	// drain closes the current session when the time left by a GoAway
+	// is over. attempts counts the resume attempts since the last message
+	// from the model. They are used by Receive only.
+	drain    *time.Timer
+	attempts int
+
+	mu sync.Mutex
+	// handle is the latest session resumption handle, if any
+	handle    string
+	current   liveUpstream
+	switching bool
+	buffered  []func(liveUpstream) error
+	closed    bool
+}
+
+// newResumableSession connects to the model with dial, see withResumption.
+func newResumableSession(ctx context.Context, dial func(ctx context.Context, handle string) (liveUpstream, error)) (*resumableSession, error) {
+	session, err := dial(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return &resumableSession{
+		ctx:     ctx,
+		dial:    dial,
+		backoff: resumeBackoff,
+		current: session,
+	}, nil
+}
+
+// withResumption returns a dial function for newResumableSession, which
+// connects with connect, with session resumption and context window
+// compression enabled in config.
+func withResumption(config *genai.LiveConnectConfig, connect func(ctx context.Context, config *genai.LiveConnectConfig) (liveUpstream, error)) func(ctx context.Context, handle string) (liveUpstream, error) {
+	if config.ContextWindowCompression == nil {
+		// Without compression, the audio and video fill the context
+		// window in a few minutes
+		config.ContextWindowCompression = &genai.ContextWindowCompressionConfig{
+			SlidingWindow: &genai.SlidingWindow{},
+		}
+	}
+	return func(ctx context.Context, handle string) (liveUpstream, error) {
+		config := *config
+		config.SessionResumption = &genai.SessionResumptionConfig{Handle: handle}
+		return connect(ctx, &config)
+	}
+}
+
+func (r *resumableSession) Receive() (*genai.LiveServerMessage, error) {
+	for {
+		r.mu.Lock()
+		session := r.current
+		r.mu.Unlock()
+
+		message, err := session.Receive()
+		if err != nil {
+			if r.isClosed() || !r.resumable() {
+				return nil, err
+			}
+			if r.drain != nil {
+				r.drain.Stop()
+				r.drain = nil
+				log.Println("model connection ended after GoAway, resuming")
+			} else {
+				log.Println("model connection lost, resuming:", err)
+			}
+			if err := r.resume(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r.attempts = 0
+		if u := message.SessionResumptionUpdate; u != nil && u.Resumable && u.NewHandle != "" {
+			r.mu.Lock()
+			r.handle = u.NewHandle
+			r.mu.Unlock()
+		}
+		if message.GoAway != nil && r.resumable() && r.drain == nil {
+			// The model still sends the rest of the current turn until
+			// TimeLeft: keep receiving from this connection until it ends,
+			// or until TimeLeft is over, and then resume. The GoAway is
+			// forwarded to the browser as well.
+			log.Printf("model going away in %v", message.GoAway.TimeLeft)
+			r.drain = time.AfterFunc(message.GoAway.TimeLeft, func() {
+				session.Close()
+			})
+		}
+		return message, nil
+	}
+}
+
+// resume reconnects until it succeeds, with a backoff between the attempts.
+// A connection that ends before any message from the model counts as a
+// failed attempt as well: after maxResumeAttempts, resume returns the error,
+// which ends the browser session. The browser input is buffered meanwhile.
+func (r *resumableSession) resume(cause error) (err error) {
+	r.mu.Lock()
+	r.switching = true
+	r.mu.Unlock()
+	defer func() {
+		if err != nil {
+			r.mu.Lock()
+			r.switching = false
+			r.mu.Unlock()
+		}
+	}()
+	for {
+		r.attempts++
+		if r.attempts > maxResumeAttempts {
+			return fmt.Errorf("resuming session: giving up after %d attempts: %w", maxResumeAttempts, cause)
+		}
+		if r.attempts > 1 {
+			delay := r.backoff << (r.attempts - 2)
+			log.Printf("resume attempt %d in %v", r.attempts, delay)
+			select {
+			case <-time.After(delay):
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			}
+		}
+		err := r.reconnect()
+		if err == nil {
+			return nil
+		}
+		if r.isClosed() || r.ctx.Err() != nil {
+			return err
+		}
+		log.Printf("resume attempt %d: %v", r.attempts, err)
+		cause = err
+	}
+}
+
+// reconnect connects a new session with the latest handle, replaces the
+// current one, and sends it the browser input buffered meanwhile. It is
+// called while switching.
+//
+// The network writes happen without holding r.mu, so that Close is never
+// blocked by a stalled connection.
+func (r *resumableSession) reconnect() error {
+	r.mu.Lock()
+	handle := r.handle
+	r.mu.Unlock()
+
+	session, err := r.dial(r.ctx, handle)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		session.Close()
+		return errors.New("session closed while resuming")
+	}
+	previous := r.current
+	r.current = session
+	r.mu.Unlock()
+	previous.Close()
+
+	// Flush the buffer in order. The input received meanwhile is still
+	// buffered, until the buffer is empty.
+	sent := 0
+	for {
+		r.mu.Lock()
+		batch := r.buffered
+		r.buffered = nil
+		if len(batch) == 0 {
+			r.switching = false
+			r.mu.Unlock()
+			break
+		}
+		r.mu.Unlock()
+		for i, send := range batch {
+			if err := send(session); err != nil {
+				// Keep the unsent input for the next attempt
+				r.mu.Lock()
+				r.buffered = append(batch[i:], r.buffered...)
+				r.mu.Unlock()
+				return fmt.Errorf("sending buffered input: %w", err)
+			}
+			sent++
+		}
+	}
+	log.Printf("session resumed, %d buffered messages sent", sent)
+	return nil
+}
+
+// send sends now, or buffers while switching sessions. It also buffers
+// when the connection has just dropped, as Receive will resume it. Once
+// something is buffered, the next input is buffered as well, to keep the
+// order.
+func (r *resumableSession) send(f func(liveUpstream) error) error {
+	r.mu.Lock()
+	for !r.switching && len(r.buffered) == 0 {
+		current := r.current
+		r.mu.Unlock()
+		err := f(current)
+		if err == nil {
+			return nil
+		}
+		r.mu.Lock()
+		if r.handle == "" || r.closed {
+			r.mu.Unlock()
+			return err
+		}
+		if r.current == current {
+			break
+		}
+		// Resumed meanwhile: send to the new session
+	}
+	defer r.mu.Unlock()
+	if len(r.buffered) == maxBufferedInputs {
+		r.buffered = r.buffered[1:]
+	}
+	r.buffered = append(r.buffered, f)
+	return nil
+}
+
+func (r *resumableSession) resumable() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.handle != ""
+}
+
+func (r *resumableSession) SendRealtimeInput(input genai.LiveRealtimeInput) error {
+	return r.send(func(s liveUpstream) error {
+		return s.SendRealtimeInput(input)
+	})
+}
+
+func (r *resumableSession) SendToolResponse(input genai.LiveToolResponseInput) error {
+	return r.send(func(s liveUpstream) error {
+		return s.SendToolResponse(input)
+	})
+}
+
+func (r *resumableSession) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+func (r *resumableSession) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return r.current.Close()
+}
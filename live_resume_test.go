@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// resumeTest is a resumableSession connected to fake models. Each dial
+// takes the next fake model of upstreams, or fails if it is nil.
+type resumeTest struct {
+	t         *testing.T
+	session   *resumableSession
+	first     *fakeUpstream
+	upstreams chan *fakeUpstream
+
+	mu      sync.Mutex
+	handles []string
+}
+
+func startResumeTest(t *testing.T) *resumeTest {
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := &resumeTest{
+		t:         t,
+		first:     newFakeUpstream(),
+		upstreams: make(chan *fakeUpstream, 10),
+	}
+	rt.upstreams <- rt.first
+	session, err := newResumableSession(ctx, func(ctx context.Context, handle string) (liveUpstream, error) {
+		rt.mu.Lock()
+		rt.handles = append(rt.handles, handle)
+		rt.mu.Unlock()
+		select {
+		case u := <-rt.upstreams:
+			if u == nil {
+				return nil, errors.New("dial failed")
+			}
+			return u, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.backoff = time.Millisecond
+	rt.session = session
+	t.Cleanup(func() {
+		cancel()
+		session.Close()
+	})
+	return rt
+}
+
+// dialedHandles returns the handle of each dial so far.
+func (rt *resumeTest) dialedHandles() []string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return slices.Clone(rt.handles)
+}
+
+// receive calls Receive, with a timeout.
+func (rt *resumeTest) receive() (*genai.LiveServerMessage, error) {
+	rt.t.Helper()
+	type result struct {
+		message *genai.LiveServerMessage
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		message, err := rt.session.Receive()
+		done <- result{message, err}
+	}()
+	select {
+	case r := <-done:
+		return r.message, r.err
+	case <-time.After(5 * time.Second):
+		rt.t.Fatal("Receive is blocked")
+		return nil, nil
+	}
+}
+
+// mustReceive calls Receive, and checks that the message has the text.
+func (rt *resumeTest) mustReceive(text string) {
+	rt.t.Helper()
+	message, err := rt.receive()
+	if err != nil {
+		rt.t.Fatalf("Receive error: %v, want %q", err, text)
+	}
+	if got := messageText(message); got != text {
+		rt.t.Fatalf("Receive got %q, want %q", got, text)
+	}
+}
+
+// getHandle receives a new session resumption handle from the first model.
+func (rt *resumeTest) getHandle(handle string) {
+	rt.t.Helper()
+	rt.first.messages <- &genai.LiveServerMessage{
+		SessionResumptionUpdate: &genai.LiveServerSessionResumptionUpdate{NewHandle: handle, Resumable: true},
+	}
+	if _, err := rt.receive(); err != nil {
+		rt.t.Fatal(err)
+	}
+}
+
+func (rt *resumeTest) send(text string) {
+	rt.t.Helper()
+	if err := rt.session.SendRealtimeInput(genai.LiveRealtimeInput{Text: text}); err != nil {
+		rt.t.Fatalf("send %q: %v", text, err)
+	}
+}
+
+func textMessage(text string) *genai.LiveServerMessage {
+	return &genai.LiveServerMessage{
+		ServerContent: &genai.LiveServerContent{
+			ModelTurn: &genai.Content{Parts: []*genai.Part{{Text: text}}},
+		},
+	}
+}
+
+func messageText(message *genai.LiveServerMessage) string {
+	if sc := message.ServerContent; sc != nil && sc.ModelTurn != nil && len(sc.ModelTurn.Parts) > 0 {
+		return sc.ModelTurn.Parts[0].Text
+	}
+	return ""
+}
+
+// checkInputs checks that the model got exactly these texts, in order.
+func checkInputs(t *testing.T, u *fakeUpstream, texts ...string) {
+	t.Helper()
+	for _, text := range texts {
+		select {
+		case input := <-u.inputs:
+			if input.Text != text {
+				t.Fatalf("model got %q, want %q", input.Text, text)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("model got no input, want %q", text)
+		}
+	}
+	select {
+	case input := <-u.inputs:
+		t.Fatalf("model got unexpected %q", input.Text)
+	default:
+	}
+}
+
+func TestResumeGoAwayDrain(t *testing.T) {
+	rt := startResumeTest(t)
+	rt.getHandle("h1")
+
+	// The rest of the turn still comes from the first connection
+	rt.first.messages <- &genai.LiveServerMessage{GoAway: &genai.LiveServerGoAway{TimeLeft: time.Minute}}
+	rt.first.messages <- textMessage("end of turn")
+	if message, err := rt.receive(); err != nil || message.GoAway == nil {
+		t.Fatalf("Receive got %v, %v, want the GoAway", message, err)
+	}
+	rt.mustReceive("end of turn")
+	if handles := rt.dialedHandles(); len(handles) != 1 {
+		t.Fatalf("dialed %q before the end of the turn", handles)
+	}
+
+	// Then the model closes the connection, and the session resumes
+	second := newFakeUpstream()
+	second.messages <- textMessage("resumed")
+	rt.upstreams <- second
+	rt.first.Close()
+	rt.mustReceive("resumed")
+	if handles := rt.dialedHandles(); !slices.Equal(handles, []string{"", "h1"}) {
+		t.Errorf("dialed with handles %q, want the latest handle", handles)
+	}
+}
+
+func TestResumeGoAwayTimeLeft(t *testing.T) {
+	rt := startResumeTest(t)
+	rt.getHandle("h1")
+
+	// The first connection is closed when TimeLeft is over
+	rt.first.messages <- &genai.LiveServerMessage{GoAway: &genai.LiveServerGoAway{TimeLeft: 10 * time.Millisecond}}
+	if _, err := rt.receive(); err != nil {
+		t.Fatal(err)
+	}
+	second := newFakeUpstream()
+	second.messages <- textMessage("resumed")
+	rt.upstreams <- second
+	rt.mustReceive("resumed")
+	select {
+	case <-rt.first.closed:
+	default:
+		t.Error("the first connection is not closed")
+	}
+}
+
+func TestResumeDrop(t *testing.T) {
+	rt := startResumeTest(t)
+	rt.getHandle("h1")
+
+	second := newFakeUpstream()
+	second.messages <- textMessage("resumed")
+	rt.upstreams <- second
+	rt.first.errs <- errors.New("connection reset")
+	rt.mustReceive("resumed")
+	if handles := rt.dialedHandles(); !slices.Equal(handles, []string{"", "h1"}) {
+		t.Errorf("dialed with handles %q, want the latest handle", handles)
+	}
+}
+
+func TestResumeDropWithoutHandle(t *testing.T) {
+	rt := startResumeTest(t)
+
+	rt.first.errs <- errors.New("connection reset")
+	if _, err := rt.receive(); err == nil {
+		t.Fatal("Receive error is nil, want the connection error")
+	}
+	if handles := rt.dialedHandles(); len(handles) != 1 {
+		t.Errorf("dialed %q, want no resume without a handle", handles)
+	}
+}
+
+func TestResumeGiveUp(t *testing.T) {
+	rt := startResumeTest(t)
+	rt.getHandle("h1")
+
+	// The attempts fail to connect, or connect and drop before any
+	// message from the model
+	for i := range maxResumeAttempts {
+		if i%2 == 0 {
+			rt.upstreams <- nil
+			continue
+		}
+		broken := newFakeUpstream()
+		broken.errs <- errors.New("connection reset")
+		rt.upstreams <- broken
+	}
+	rt.first.errs <- errors.New("connection reset")
+	if _, err := rt.receive(); err == nil {
+		t.Fatal("Receive error is nil, want an error after the failed attempts")
+	}
+	if handles := rt.dialedHandles(); len(handles) != 1+maxResumeAttempts {
+		t.Errorf("%d dials, want %d", len(handles), 1+maxResumeAttempts)
+	}
+}
+
+func TestResumeBufferedInput(t *testing.T) {
+	rt := startResumeTest(t)
+	rt.getHandle("h1")
+
+	// Resume, and block in dial until the second model is ready
+	rt.first.errs <- errors.New("connection reset")
+	received := make(chan error, 1)
+	go func() {
+		message, err := rt.session.Receive()
+		if err == nil && messageText(message) != "resumed" {
+			err = errors.New("unexpected message")
+		}
+		received <- err
+	}()
+	for len(rt.dialedHandles()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The input sent during the switch is buffered
+	rt.send("a")
+	rt.send("b")
+	second := newFakeUpstream()
+	second.messages <- textMessage("resumed")
+	rt.upstreams <- second
+	if err := <-received; err != nil {
+		t.Fatal(err)
+	}
+	rt.send("c")
+	checkInputs(t, second, "a", "b", "c")
+	checkInputs(t, rt.first)
+}
+
+func TestResumeSendOrder(t *testing.T) {
+	rt := startResumeTest(t)
+	rt.getHandle("h1")
+
+	// The first send fails, before Receive notices the drop: the next
+	// input must not overtake it
+	rt.first.sendErrs <- errors.New("broken pipe")
+	rt.send("a")
+	rt.send("b")
+	checkInputs(t, rt.first)
+
+	second := newFakeUpstream()
+	second.messages <- textMessage("resumed")
+	rt.upstreams <- second
+	rt.first.errs <- errors.New("connection reset")
+	rt.mustReceive("resumed")
+	checkInputs(t, second, "a", "b")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"google.golang.org/genai"
+)
+
+// liveSetup is the session setup chosen in the browser, and sent as query
+// parameters of the WebSocket URL.
+type liveSetup struct {
+	Voice string
+	// Modality is "audio", "text", or "both".
+	Modality string
+	// Language is a BCP-47 language code, or empty for automatic.
+	Language string
+	// Persona is a key of the personas passed to config.
+	Persona       string
+	Transcription bool
+}
+
+// liveOptions are the setup values accepted by a Live API model.
+type liveOptions struct {
+	Voices     []string
+	Modalities []string
+	// Languages are the accepted language codes. The empty string means
+	// the automatic choice of the model.
+	Languages []string
+}
+
+// nativeAudioVoices are the prebuilt voices of the native audio models.
+var nativeAudioVoices = []string{
+	"Zephyr", "Puck", "Charon", "Kore", "Fenrir", "Leda", "Orus", "Aoede",
+	"Callirrhoe", "Autonoe", "Enceladus", "Iapetus", "Umbriel", "Algieba",
+	"Despina", "Erinome", "Algenib", "Rasalgethi", "Laomedeia", "Achernar",
+	"Alnilam", "Schedar", "Gacrux", "Pulcherrima", "Achird", "Zubenelgenubi",
+	"Vindemiatrix", "Sadachbia", "Sadaltager", "Sulafat",
+}
+
+// liveModelOptions is the allowlist of the setup values per model.
+//
+// The native audio models choose the language automatically, and speak only
+// audio. No Live model currently accepts both audio and text responses.
+var liveModelOptions = map[string]liveOptions{
+	"gemini-2.5-flash-native-audio-preview-09-2025": {
+		Voices:     nativeAudioVoices,
+		Modalities: []string{"audio"},
+		Languages:  []string{""},
+	},
+	"gemini-live-2.5-flash-preview-native-audio-09-2025": {
+		Voices:     nativeAudioVoices,
+		Modalities: []string{"audio"},
+		Languages:  []string{""},
+	},
+	"gemini-live-2.5-flash-preview": {
+		// e.g. Gacrux and Achird are not available for this model
+		Voices:     []string{"Zephyr", "Puck", "Charon", "Kore", "Fenrir", "Leda", "Orus", "Aoede"},
+		Modalities: []string{"audio", "text"},
+		Languages:  []string{"", "en-US", "fr-FR", "de-DE", "es-US", "it-IT", "ja-JP", "pt-BR", "hi-IN"},
+	},
+}
+
+// parseLiveSetup reads the setup from the query parameters voice, modality,
+// language, persona, transcription. The missing ones get their default value.
+func parseLiveSetup(query url.Values) (liveSetup, error) {
+	setup := liveSetup{
+		Voice:         query.Get("voice"),
+		Modality:      query.Get("modality"),
+		Language:      query.Get("language"),
+		Persona:       query.Get("persona"),
+		Transcription: true,
+	}
+	if setup.Modality == "" {
+		setup.Modality = "audio"
+	}
+	if t := query.Get("transcription"); t != "" {
+		var err error
+		if setup.Transcription, err = strconv.ParseBool(t); err != nil {
+			return setup, fmt.Errorf("invalid transcription %q", t)
+		}
+	}
+	return setup, nil
+}
+
+// config validates the setup against the allowlist of the model, and
+// builds the LiveConnectConfig. personas maps the persona names to their
+// system instruction.
+func (setup liveSetup) config(model string, personas map[string]string) (*genai.LiveConnectConfig, error) {
+	options, ok := liveModelOptions[model]
+	if !ok {
+		return nil, fmt.Errorf("no setup options for model %s", model)
+	}
+	if setup.Voice != "" && !slices.Contains(options.Voices, setup.Voice) {
+		return nil, fmt.Errorf("voice %q is not available for model %s", setup.Voice, model)
+	}
+	if !slices.Contains(options.Modalities, setup.Modality) {
+		return nil, fmt.Errorf("modality %q is not available for model %s", setup.Modality, model)
+	}
+	if !slices.Contains(options.Languages, setup.Language) {
+		return nil, fmt.Errorf("language %q is not available for model %s", setup.Language, model)
+	}
+	instruction, ok := personas[setup.Persona]
+	if !ok {
+		return nil, fmt.Errorf("unknown persona %q", setup.Persona)
+	}
+
+	config := &genai.LiveConnectConfig{}
+	if instruction != "" {
+		config.SystemInstruction = &genai.Content{
+			Parts: []*genai.Part{{Text: instruction}},
+		}
+	}
+	switch setup.Modality {
+	case "audio":
+		config.ResponseModalities = []genai.Modality{genai.ModalityAudio}
+	case "text":
+		config.ResponseModalities = []genai.Modality{genai.ModalityText}
+	case "both":
+		config.ResponseModalities = []genai.Modality{genai.ModalityAudio, genai.ModalityText}
+	}
+	if setup.Voice != "" || setup.Language != "" {
+		config.SpeechConfig = &genai.SpeechConfig{LanguageCode: setup.Language}
+		if setup.Voice != "" {
+			config.SpeechConfig.VoiceConfig = &genai.VoiceConfig{
+				PrebuiltVoiceConfig: &genai.PrebuiltVoiceConfig{
+					VoiceName: setup.Voice,
+				},
+			}
+		}
+	}
+	if setup.Transcription {
+		config.InputAudioTranscription = &genai.AudioTranscriptionConfig{}
+		if setup.Modality != "text" {
+			config.OutputAudioTranscription = &genai.AudioTranscriptionConfig{}
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+var lookupFile = flag.String("lookup-file", "testdata/lookup.json", "sample 7: JSON file of the facts available to the lookup tool")
+
+// LiveTool is a Go function that the model can call during a live session.
+type LiveTool struct {
+	// Declaration describes the function to the model.
+	Declaration *genai.FunctionDeclaration
+	// Call runs the function with the arguments chosen by the model.
+	// It should return promptly when ctx is done, i.e. when the call
+	// times out or is cancelled by the model.
+	Call func(ctx context.Context, args map[string]any) (map[string]any, error)
+}
+
+// toolEvent is the frame sent to the browser to show the tool activity.
+type toolEvent struct {
+	ID   string         `json:"id"`
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+	// Status is one of "started", "done", "error", "cancelled".
+	Status string         `json:"status"`
+	Result map[string]any `json:"result,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+func (p *LiveProxy) toolDeclarations() *genai.Tool {
+	tool := &genai.Tool{}
+	for _, t := range p.Tools {
+		tool.FunctionDeclarations = append(tool.FunctionDeclarations, t.Declaration)
+	}
+	return tool
+}
+
+func (p *LiveProxy) toolTimeout() time.Duration {
+	if p.ToolTimeout > 0 {
+		return p.ToolTimeout
+	}
+	return 10 * time.Second
+}
+
+// startToolCalls runs the function calls concurrently. Each call replies to
+// the model with its own tool response.
+func (p *LiveProxy) startToolCalls(s *LiveSession, calls []*genai.FunctionCall) {
+	for _, call := range calls {
+		ctx, cancel := context.WithTimeout(s.ctx, p.toolTimeout())
+		s.mu.Lock()
+		if s.toolCalls == nil {
+			s.toolCalls = make(map[string]context.CancelFunc)
+		}
+		s.toolCalls[call.ID] = cancel
+		s.mu.Unlock()
+
+		s.goroutines.Add(1)
+		go func() {
+			defer s.goroutines.Done()
+			defer cancel()
+			p.runToolCall(ctx, s, call)
+			s.mu.Lock()
+			delete(s.toolCalls, call.ID)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// cancelToolCalls stops the calls that the model doesn't need anymore,
+// e.g. because the user interrupted it.
+func (p *LiveProxy) cancelToolCalls(s *LiveSession, ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if cancel, ok := s.toolCalls[id]; ok {
+			cancel()
+		}
+	}
+}
+
+func (p *LiveProxy) runToolCall(ctx context.Context, s *LiveSession, call *genai.FunctionCall) {
+	log.Printf("Tool call %s(%v)", call.Name, call.Args)
+	s.sendToolEvent(toolEvent{ID: call.ID, Name: call.Name, Args: call.Args, Status: "started"})
+
+	result, err := p.callTool(ctx, call)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		if s.ctx.Err() == nil {
+			// Cancelled by the model: it doesn't expect a response
+			log.Printf("Tool call %s cancelled", call.Name)
+			s.sendToolEvent(toolEvent{ID: call.ID, Name: call.Name, Status: "cancelled"})
+		}
+		return
+	}
+
+	response := &genai.FunctionResponse{ID: call.ID, Name: call.Name}
+	if err != nil {
+		log.Printf("Tool call %s error: %v", call.Name, err)
+		response.Response = map[string]any{"error": err.Error()}
+		s.sendToolEvent(toolEvent{ID: call.ID, Name: call.Name, Status: "error", Error: err.Error()})
+	} else {
+		response.Response = map[string]any{"output": result}
+		s.sendToolEvent(toolEvent{ID: call.ID, Name: call.Name, Status: "done", Result: result})
+	}
+
+	s.sendMu.Lock()
+	err = s.session.SendToolResponse(genai.LiveToolResponseInput{
+		FunctionResponses: []*genai.FunctionResponse{response},
+	})
+	s.sendMu.Unlock()
+	if err != nil && s.ctx.Err() == nil {
+		log.Println("send tool response error:", err)
+	}
+}
+
+// callTool runs the tool, and stops waiting for it when ctx is done.
+func (p *LiveProxy) callTool(ctx context.Context, call *genai.FunctionCall) (map[string]any, error) {
+	i := slices.IndexFunc(p.Tools, func(t LiveTool) bool {
+		return t.Declaration.Name == call.Name
+	})
+	if i == -1 {
+		return nil, fmt.Errorf("unknown function %q", call.Name)
+	}
+	type callResult struct {
+		result map[string]any
+		err    error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		result, err := p.Tools[i].Call(ctx, call.Args)
+		done <- callResult{result, err}
+	}()
+	select {
+	case r := <-done:
+		return r.result, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s timed out after %v", call.Name, p.toolTimeout())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *LiveSession) sendToolEvent(e toolEvent) {
+	frame, err := json.Marshal(map[string]toolEvent{"toolEvent": e})
+	if err != nil {
+		log.Println("marshal tool event error:", err)
+		return
+	}
+	s.rec.proxy("toolEvent", frame)
+	if err := s.conn.writeText(frame); err != nil && s.ctx.Err() == nil {
+		log.Println("write tool event error:", err)
+	}
+}
+
+// currentTimeTool tells the current date and time, in an optional time zone.
+var currentTimeTool = LiveTool{
+	Declaration: &genai.FunctionDeclaration{
+		Name:        "get_current_time",
+		Description: "Returns the current date and time.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"timezone": {
+					Type:        genai.TypeString,
+					Description: "IANA time zone name, e.g. Europe/Paris. Defaults to the server time zone.",
+				},
+			},
+		},
+	},
+	Call: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+		loc := time.Local
+		if tz, _ := args["timezone"].(string); tz != "" {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return nil, err
+			}
+		}
+		now := time.Now().In(loc)
+		return map[string]any{
+			"time":     now.Format(time.RFC3339),
+			"weekday":  now.Weekday().String(),
+			"timezone": loc.String(),
+		}, nil
+	},
+}
+
+// jsonLookupTool looks up a key in a local JSON file containing an object.
+// The file is read at each call, so that it can be edited while the
+// server is running.
+func jsonLookupTool(path string) LiveTool {
+	return LiveTool{
+		Declaration: &genai.FunctionDeclaration{
+			Name:        "lookup",
+			Description: "Looks up a fact in the local knowledge base. If the key is unknown, returns the list of the known keys.",
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"key": {Type: genai.TypeString, Description: "The key of the fact."},
+				},
+				Required: []string{"key"},
+			},
+		},
+		Call: func(ctx context.Context, args map[string]any) (map[string]any, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			var facts map[string]any
+			if err := json.Unmarshal(data, &facts); err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", path, err)
+			}
+			key, _ := args["key"].(string)
+			if value, ok := facts[key]; ok {
+				return map[string]any{"key": key, "value": value}, nil
+			}
+			keys := make([]string, 0, len(facts))
+			for k := range facts {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			return map[string]any{"key": key, "found": false, "known_keys": keys}, nil
+		},
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/genai"
+)
+
+// To run this sample with a Gemini API key:
+//
+// $ export GOOGLE_API_KEY=xxxxxxxxxx
+// $ go run . -n=10
+
+func sample10_compareImages(ctx context.Context) error {
+	modelName := "gemini-2.5-flash"
+
+	//
+	// Several images in the same prompt
+	//
+	paths, err := filepath.Glob("./testdata/forbiddenwords/*.png")
+	if err != nil {
+		return err
+	}
+	paths = append(paths, "./testdata/pool.png", "./testdata/lion.jpg")
+	images, err := loadLabeledImages(paths)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		fmt.Printf("Image %s: %s\n", img.Label, img.Path)
+	}
+	fmt.Println()
+
+	question1 := "Which images show the same character? Group them, and refer to each image by its label."
+	if err := askAboutImages(ctx, modelName, images, question1); err != nil {
+		return err
+	}
+
+	//
+	// Refer to specific images, by their labels
+	//
+	referee, err := findImage(images, "referee.png")
+	if err != nil {
+		return err
+	}
+	refereeOpenMouth, err := findImage(images, "referee_openmouth.png")
+	if err != nil {
+		return err
+	}
+	question2 := fmt.Sprintf("What changed between Image %s and Image %s?", referee.Label, refereeOpenMouth.Label)
+	if err := askAboutImages(ctx, modelName, []labeledImage{referee, refereeOpenMouth}, question2); err != nil {
+		return err
+	}
+
+	//
+	// Exercise:
+	// ask which image is the odd one out.
+	//
+
+	return nil
+}
+
+// labeledImage is an image that the prompt refers to by its Label, e.g. "A".
+type labeledImage struct {
+	Label    string
+	Path     string
+	Data     []byte
+	MIMEType string
+}
+
+// loadLabeledImages reads the image files, and labels them "A", "B", "C"...
+func loadLabeledImages(paths []string) ([]labeledImage, error) {
+	images := make([]labeledImage, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = labeledImage{
+			Label:    imageLabel(i),
+			Path:     path,
+			Data:     data,
+			MIMEType: http.DetectContentType(data),
+		}
+	}
+	return images, nil
+}
+
+// imageLabel returns "A" for 0, "B" for 1, ..., "Z" for 25, "AA" for 26, etc.
+func imageLabel(i int) string {
+	label := ""
+	for i >= 0 {
+		label = string(rune('A'+i%26)) + label
+		i = i/26 - 1
+	}
+	return label
+}
+
+// findImage returns the image whose file name is name.
+func findImage(images []labeledImage, name string) (labeledImage, error) {
+	for _, img := range images {
+		if filepath.Base(img.Path) == name {
+			return img, nil
+		}
+	}
+	return labeledImage{}, fmt.Errorf("image %q not found", name)
+}
+
+// labeledImagesParts interleaves a text part "Image A:" before each image part,
+// so that the prompt can unambiguously refer to each image.
+func labeledImagesParts(images []labeledImage) []*genai.Part {
+	var parts []*genai.Part
+	for _, img := range images {
+		parts = append(parts,
+			genai.NewPartFromText(fmt.Sprintf("Image %s:", img.Label)),
+			genai.NewPartFromBytes(img.Data, img.MIMEType),
+		)
+	}
+	return parts
+}
+
+func askAboutImages(ctx context.Context, modelName string, images []labeledImage, question string) error {
+	fmt.Println("Question:", question)
+	fmt.Println()
+
+	parts := labeledImagesParts(images)
+	parts = append(parts, genai.NewPartFromText(question))
+	multimodalPrompt := []*genai.Content{{Parts: parts}}
+	result, err := client.Models.GenerateContent(ctx, modelName, multimodalPrompt, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Answer:", textOf(result))
+	fmt.Println()
+	return nil
+}
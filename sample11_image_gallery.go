@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	_ "embed"
+
+	"google.golang.org/genai"
+)
+
+// To run this sample with a VertexAI Google Cloud project:
+//
+// $ export GOOGLE_GENAI_USE_VERTEXAI=true
+// $ export GOOGLE_CLOUD_PROJECT=xxxxxxxxx
+// $ export GOOGLE_CLOUD_LOCATION=us-central1
+// $ gcloud auth application-default login
+// $ gcloud services enable aiplatform.googleapis.com
+// $ go run . -n=11
+
+const galleryModel = "imagen-3.0-generate-002"
+
+// gallery is the state of the image generation web app.
+// The history of the generated images lives on disk, in outputs.
+type gallery struct {
+	outputs *imageOutputs
+}
+
+func sample11_imageGallery(ctx context.Context) error {
+	log.SetFlags(0)
+	outputs, err := newImageOutputs(*outDir)
+	if err != nil {
+		return err
+	}
+	g := &gallery{outputs: outputs}
+	http.HandleFunc("/", g.home)
+	http.HandleFunc("POST /generate", g.generate)
+	http.HandleFunc("POST /upscale", g.upscale)
+	http.HandleFunc("POST /regenerate", g.regenerate)
+	http.Handle("/images/", http.StripPrefix("/images/", http.FileServer(http.Dir(outputs.dir))))
+
+	// Determine port for HTTP service.
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+		log.Printf("defaulting to port %s", port)
+	}
+
+	// Start HTTP server.
+	log.Printf("listening on port %s", port)
+	return http.ListenAndServe(":"+port, nil)
+}
+
+//go:embed sample11_image_gallery.html
+var galleryPage string
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(galleryPage))
+
+// home shows the prompt form, and all the previously generated images, newest first.
+func (g *gallery) home(w http.ResponseWriter, r *http.Request) {
+	gens, err := g.outputs.list()
+	if err != nil {
+		http.Error(w, "Error reading history", http.StatusInternalServerError)
+		log.Println("list error:", err)
+		return
+	}
+	slices.Reverse(gens)
+	err = galleryTemplate.Execute(w, map[string]any{
+		"Generations":  gens,
+		"AspectRatios": aspectRatios,
+	})
+	if err != nil {
+		log.Println("template error:", err)
+	}
+}
+
+// generate creates new images from the prompt form.
+func (g *gallery) generate(w http.ResponseWriter, r *http.Request) {
+	prompt := r.FormValue("prompt")
+	if prompt == "" {
+		http.Error(w, "Missing prompt", http.StatusBadRequest)
+		return
+	}
+	config, err := imagesConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, err := strconv.Atoi(r.FormValue("count")); err == nil && 1 <= n && n <= 4 {
+		config.NumberOfImages = int32(n)
+	}
+	if ratio := r.FormValue("aspectRatio"); ratio != "" {
+		if !slices.Contains(aspectRatios, ratio) {
+			http.Error(w, "Invalid aspect ratio", http.StatusBadRequest)
+			return
+		}
+		config.AspectRatio = ratio
+	}
+	config.NegativePrompt = r.FormValue("negativePrompt")
+	if r.FormValue("reproducible") != "" {
+		// An explicit seed lets us regenerate the same images later.
+		// The seed is not supported when the watermark is enabled.
+		config.Seed = genai.Ptr(rand.Int32())
+		setWatermark(config, false)
+	}
+
+	g.generateAndRedirect(w, r, galleryModel, prompt, config)
+}
+
+// regenerate runs again the generation of an image, with the same model,
+// prompt, settings and seed.
+func (g *gallery) regenerate(w http.ResponseWriter, r *http.Request) {
+	gen, err := g.outputs.load(r.FormValue("image"))
+	if err != nil {
+		http.Error(w, "Unknown image", http.StatusNotFound)
+		return
+	}
+	g.generateAndRedirect(w, r, gen.Model, gen.Prompt, gen.Config)
+}
+
+func (g *gallery) generateAndRedirect(w http.ResponseWriter, r *http.Request, modelName string, prompt string, config *genai.GenerateImagesConfig) {
+	log.Printf("Generating %d image(s) with %s for prompt %q", config.NumberOfImages, modelName, prompt)
+	gens, err := generateImages(r.Context(), g.outputs, modelName, prompt, config)
+	if err != nil {
+		http.Error(w, "Error generating images: "+err.Error(), http.StatusInternalServerError)
+		log.Println("generate error:", err)
+		return
+	}
+	log.Printf("Generated %d image(s)", len(gens))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// upscale upscales an image, using the same code path as sample 6.
+func (g *gallery) upscale(w http.ResponseWriter, r *http.Request) {
+	gen, err := g.outputs.load(r.FormValue("image"))
+	if err != nil {
+		http.Error(w, "Unknown image", http.StatusNotFound)
+		return
+	}
+	imgdata, err := os.ReadFile(filepath.Join(g.outputs.dir, gen.Image))
+	if err != nil {
+		http.Error(w, "Error reading image", http.StatusInternalServerError)
+		return
+	}
+	factor := "x2"
+	if r.FormValue("factor") == "x4" {
+		factor = "x4"
+	}
+	if _, err := checkUpscale(imgdata, factor); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Upscaling %s %s", gen.Image, factor)
+	upscaled, err := upscaleImage(r.Context(), galleryModel, imgdata, http.DetectContentType(imgdata), factor)
+	if err != nil {
+		http.Error(w, "Error upscaling image: "+err.Error(), http.StatusInternalServerError)
+		log.Println("upscale error:", err)
+		return
+	}
+	if _, err := g.outputs.saveUpscaled(gen, upscaled, factor); err != nil {
+		http.Error(w, "Error saving upscaled image", http.StatusInternalServerError)
+		log.Println("save error:", err)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
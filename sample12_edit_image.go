@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// To run this sample with a VertexAI Google Cloud project:
+//
+// $ export GOOGLE_GENAI_USE_VERTEXAI=true
+// $ export GOOGLE_CLOUD_PROJECT=xxxxxxxxx
+// $ export GOOGLE_CLOUD_LOCATION=us-central1
+// $ gcloud auth application-default login
+// $ gcloud services enable aiplatform.googleapis.com
+// $ go run . -n=12
+//
+// By default, this removes the ball 13 from the pool image.
+//
+// To insert something in a polygon area:
+//
+// $ go run . -n=12 -edit-mode=inpaint-insert -mask-polygon="40,700 400,700 220,900" -edit-prompt="A small white cat"
+//
+// To extend the lion image to 16:9:
+//
+// $ go run . -n=12 -edit-mode=outpaint -edit-input=./testdata/lion.jpg
+
+var (
+	editMode      = flag.String("edit-mode", "inpaint-remove", "sample 12: inpaint-insert, inpaint-remove or outpaint")
+	editInput     = flag.String("edit-input", "./testdata/pool.png", "sample 12: the image to edit")
+	editPrompt    = flag.String("edit-prompt", "", "sample 12: what to paint in the masked area")
+	maskRect      = flag.String("mask-rect", "815,400,1085,685", "sample 12: area to edit, as x0,y0,x1,y1 in pixels")
+	maskPolygon   = flag.String("mask-polygon", "", "sample 12: area to edit, as space-separated x,y points in pixels")
+	maskAuto      = flag.String("mask-auto", "", "sample 12: let the model compute the mask: foreground or background")
+	outpaintRatio = flag.String("outpaint-ratio", "16:9", "sample 12: aspect ratio of the outpainted canvas, e.g. 16:9")
+)
+
+func sample12_editImage(ctx context.Context) error {
+	modelName := "imagen-3.0-capability-001"
+
+	imgdata, err := os.ReadFile(*editInput)
+	if err != nil {
+		return err
+	}
+	img, err := decodeImage(imgdata)
+	if err != nil {
+		return err
+	}
+
+	var mode genai.EditMode
+	var mask *image.Gray
+	switch *editMode {
+	case "inpaint-insert":
+		mode = genai.EditModeInpaintInsertion
+	case "inpaint-remove":
+		mode = genai.EditModeInpaintRemoval
+	case "outpaint":
+		mode = genai.EditModeOutpaint
+		// The raw image becomes the larger canvas, and the mask is
+		// the new area around the original image.
+		img, mask, err = outpaintCanvas(img, *outpaintRatio)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown edit mode %q", *editMode)
+	}
+
+	maskConfig := &genai.MaskReferenceConfig{
+		MaskMode:     genai.MaskReferenceModeMaskModeUserProvided,
+		MaskDilation: genai.Ptr[float32](0.03),
+	}
+	if mode != genai.EditModeOutpaint {
+		switch {
+		case *maskAuto == "foreground":
+			maskConfig.MaskMode = genai.MaskReferenceModeMaskModeForeground
+		case *maskAuto == "background":
+			maskConfig.MaskMode = genai.MaskReferenceModeMaskModeBackground
+		case *maskAuto != "":
+			return fmt.Errorf("unknown automatic mask %q", *maskAuto)
+		case *maskPolygon != "":
+			points, err := parsePoints(*maskPolygon)
+			if err != nil {
+				return err
+			}
+			mask = polygonMask(img.Bounds(), points)
+		default:
+			r, err := parseRect(*maskRect)
+			if err != nil {
+				return err
+			}
+			r = r.Intersect(img.Bounds())
+			if r.Empty() {
+				return fmt.Errorf("the mask rectangle %s is outside of the image bounds %v", *maskRect, img.Bounds())
+			}
+			mask = rectMask(img.Bounds(), r)
+		}
+	}
+
+	// The raw image, plus the mask telling which area to edit
+	raw, err := encodePNG(img)
+	if err != nil {
+		return err
+	}
+	rawRef := genai.NewRawReferenceImage(&genai.Image{ImageBytes: raw, MIMEType: "image/png"}, 1)
+	var maskImage *genai.Image
+	if mask != nil {
+		maskdata, err := encodePNG(mask)
+		if err != nil {
+			return err
+		}
+		maskImage = &genai.Image{ImageBytes: maskdata, MIMEType: "image/png"}
+		fmt.Println("Writing mask to file edit_mask.png")
+		if err := os.WriteFile("edit_mask.png", maskdata, 0644); err != nil {
+			return err
+		}
+	}
+	maskRef := genai.NewMaskReferenceImage(maskImage, 2, maskConfig)
+
+	fmt.Printf("Editing %s (%s)\n", *editInput, *editMode)
+	if *editPrompt != "" {
+		fmt.Println("Prompt:", *editPrompt)
+	}
+	fmt.Println()
+
+	config := &genai.EditImageConfig{
+		EditMode:         mode,
+		NumberOfImages:   2,
+		OutputMIMEType:   "image/png",
+		IncludeRAIReason: true,
+	}
+	result, err := client.Models.EditImage(ctx, modelName, *editPrompt, []genai.ReferenceImage{rawRef, maskRef}, config)
+	if err != nil {
+		return err
+	}
+	if len(result.GeneratedImages) == 0 {
+		return fmt.Errorf("no image generated: they may all have been filtered")
+	}
+	reportFiltered(result.GeneratedImages)
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	stamp := timestamp(time.Now())
+	for i, edited := range result.GeneratedImages {
+		if isFiltered(edited) {
+			continue
+		}
+		base := fmt.Sprintf("%s_edit-%s_%d", stamp, *editMode, i)
+		name, err := writeUniqueFile(*outDir, base, ".png", edited.Image.ImageBytes)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Wrote image to file", filepath.Join(*outDir, name))
+	}
+
+	//
+	// Exercise:
+	// replace the ball 7 with an apple.
+	//
+
+	return nil
+}
+
+// Masks are white in the area to edit, and black elsewhere.
+var (
+	maskEdit = color.Gray{Y: 255}
+	maskKeep = color.Gray{Y: 0}
+)
+
+// rectMask returns a mask of the given bounds, where only r is editable.
+func rectMask(bounds, r image.Rectangle) *image.Gray {
+	mask := image.NewGray(bounds)
+	draw.Draw(mask, r.Intersect(bounds), image.NewUniform(maskEdit), image.Point{}, draw.Src)
+	return mask
+}
+
+// polygonMask returns a mask of the given bounds, where only the inside of
+// the polygon is editable.
+func polygonMask(bounds image.Rectangle, polygon []image.Point) *image.Gray {
+	mask := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if insidePolygon(image.Pt(x, y), polygon) {
+				mask.SetGray(x, y, maskEdit)
+			}
+		}
+	}
+	return mask
+}
+
+// insidePolygon uses the even-odd rule.
+func insidePolygon(p image.Point, polygon []image.Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// outpaintCanvas centers img in a larger canvas of the given aspect ratio
+// (e.g. "16:9"), and returns the canvas and the mask of its new area.
+func outpaintCanvas(img *image.RGBA, ratio string) (*image.RGBA, *image.Gray, error) {
+	rw, rh, ok := strings.Cut(ratio, ":")
+	w, errw := strconv.Atoi(rw)
+	h, errh := strconv.Atoi(rh)
+	if !ok || errw != nil || errh != nil || w <= 0 || h <= 0 {
+		return nil, nil, fmt.Errorf("invalid aspect ratio %q", ratio)
+	}
+
+	src := img.Bounds()
+	width, height := src.Dx(), src.Dy()
+	if width*h < height*w {
+		width = height * w / h
+	} else {
+		height = width * h / w
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	offset := image.Pt((width-src.Dx())/2, (height-src.Dy())/2)
+	dst := src.Sub(src.Min).Add(offset)
+	draw.Draw(canvas, dst, img, src.Min, draw.Src)
+
+	mask := image.NewGray(canvas.Bounds())
+	draw.Draw(mask, mask.Bounds(), image.NewUniform(maskEdit), image.Point{}, draw.Src)
+	draw.Draw(mask, dst, image.NewUniform(maskKeep), image.Point{}, draw.Src)
+	return canvas, mask, nil
+}
+
+// parseRect parses "x0,y0,x1,y1".
+func parseRect(s string) (image.Rectangle, error) {
+	var r image.Rectangle
+	_, err := fmt.Sscanf(s, "%d,%d,%d,%d", &r.Min.X, &r.Min.Y, &r.Max.X, &r.Max.Y)
+	if err != nil {
+		return r, fmt.Errorf("invalid rectangle %q: %w", s, err)
+	}
+	return r.Canon(), nil
+}
+
+// parsePoints parses space-separated points "x,y x,y x,y".
+func parsePoints(s string) ([]image.Point, error) {
+	var points []image.Point
+	for _, field := range strings.Fields(s) {
+		var p image.Point
+		if _, err := fmt.Sscanf(field, "%d,%d", &p.X, &p.Y); err != nil {
+			return nil, fmt.Errorf("invalid point %q: %w", field, err)
+		}
+		points = append(points, p)
+	}
+	if len(points) < 3 {
+		return nil, fmt.Errorf("a polygon needs at least 3 points, got %d", len(points))
+	}
+	return points, nil
+}
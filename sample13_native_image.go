@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// To run this sample with a Gemini API key:
+//
+// $ export GOOGLE_API_KEY=xxxxxxxxxx
+// $ go run . -n=13
+//
+// Then type your edit instructions, one per line, e.g.
+//
+//	now make the umbrella red
+//
+// An empty line ends the session.
+
+func sample13_nativeImage(ctx context.Context) error {
+	modelName := "gemini-2.5-flash-image"
+	prompt := "Create an overly decorated umbrella."
+
+	// Unlike Imagen (samples 5 and 6), this uses GenerateContent with a
+	// Gemini model able to output images as inline data parts.
+	config := &genai.GenerateContentConfig{
+		ResponseModalities: []string{string(genai.ModalityText), string(genai.ModalityImage)},
+	}
+
+	// A chat session remembers the previous images, so that we can
+	// iteratively edit them.
+	chat, err := client.Chats.Create(ctx, modelName, config, nil)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	prefix := timestamp(time.Now()) + "_" + slug(prompt)
+
+	input := bufio.NewScanner(os.Stdin)
+	for version := 0; ; version++ {
+		fmt.Println("Prompt:", prompt)
+		result, err := chat.SendMessage(ctx, genai.Part{Text: prompt})
+		if err != nil {
+			return err
+		}
+		checkNotEmpty(result)
+		if text := allTextOf(result); text != "" {
+			fmt.Println("Answer:", text)
+		}
+		images := inlineImagesOf(result)
+		if len(images) == 0 {
+			fmt.Println("(no image in the response)")
+		}
+		for i, img := range images {
+			base := fmt.Sprintf("%s_v%d_%d", prefix, version, i)
+			name, err := writeUniqueFile(*outDir, base, extensionOf(img.MIMEType), img.Data)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Wrote image to file", filepath.Join(*outDir, name))
+		}
+		fmt.Println()
+
+		fmt.Print("Edit (empty to quit): ")
+		if !input.Scan() {
+			return input.Err()
+		}
+		prompt = strings.TrimSpace(input.Text())
+		if prompt == "" {
+			break
+		}
+	}
+
+	//
+	// Exercise:
+	// start from an existing image, e.g. ./testdata/lion.jpg, instead of a text prompt.
+	//
+
+	return nil
+}
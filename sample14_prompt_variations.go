@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+	"google.golang.org/genai"
+)
+
+// To run this sample with a VertexAI Google Cloud project:
+//
+// $ export GOOGLE_GENAI_USE_VERTEXAI=true
+// $ export GOOGLE_CLOUD_PROJECT=xxxxxxxxx
+// $ export GOOGLE_CLOUD_LOCATION=us-central1
+// $ gcloud auth application-default login
+// $ gcloud services enable aiplatform.googleapis.com
+// $ go run . -n=14 -base-prompt="Create an overly decorated umbrella." -variations=6
+
+var (
+	basePrompt = flag.String("base-prompt", "Create an overly decorated umbrella.", "sample 14: the prompt to explore variations of")
+	variations = flag.Int("variations", 4, "sample 14: number of prompt variations")
+)
+
+// promptVariation is a variation of the base prompt, suggested by a text model.
+type promptVariation struct {
+	Style       string `json:"style"`
+	Lighting    string `json:"lighting"`
+	Composition string `json:"composition"`
+	Prompt      string `json:"prompt"`
+
+	// Images are the file names of the images generated for Prompt
+	Images []string `json:"-"`
+}
+
+func (v promptVariation) label() string {
+	return fmt.Sprintf("%s / %s / %s", v.Style, v.Lighting, v.Composition)
+}
+
+func sample14_promptVariations(ctx context.Context) error {
+	textModelName := "gemini-2.5-flash"
+	imageModelName := "imagen-3.0-generate-002"
+	if *variations < 1 {
+		return fmt.Errorf("invalid number of variations %d, expected at least 1", *variations)
+	}
+
+	//
+	// Ask a text model for variations of the base prompt
+	//
+	fmt.Println("Base prompt:", *basePrompt)
+	fmt.Println()
+	question := fmt.Sprintf("Write %d variations of this image generation prompt, "+
+		"each with a distinct style, lighting and composition. "+
+		"Each variation has a full prompt, which keeps the subject of the base prompt.\n\n"+
+		"Base prompt: %s", *variations, *basePrompt)
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type:     genai.TypeArray,
+			MaxItems: genai.Ptr(int64(*variations)),
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"style":       {Type: genai.TypeString},
+					"lighting":    {Type: genai.TypeString},
+					"composition": {Type: genai.TypeString},
+					"prompt":      {Type: genai.TypeString},
+				},
+				Required:         []string{"style", "lighting", "composition", "prompt"},
+				PropertyOrdering: []string{"style", "lighting", "composition", "prompt"},
+			},
+		},
+	}
+	result, err := client.Models.GenerateContent(ctx, textModelName, genai.Text(question), config)
+	if err != nil {
+		return err
+	}
+	var vars []promptVariation
+	if err := json.Unmarshal([]byte(textOf(result)), &vars); err != nil {
+		return fmt.Errorf("decoding prompt variations: %w", err)
+	}
+	if len(vars) > *variations {
+		// The model may not respect the requested count: don't generate
+		// more images than asked.
+		vars = vars[:*variations]
+	}
+
+	//
+	// Generate images for each variation
+	//
+	dir := filepath.Join(*outDir, time.Now().Format("20060102-150405")+"_variations_"+slug(*basePrompt))
+	outputs, err := newImageOutputs(dir)
+	if err != nil {
+		return err
+	}
+	imgConfig, err := imagesConfig()
+	if err != nil {
+		return err
+	}
+	imgConfig.NumberOfImages = 2
+	for i := range vars {
+		v := &vars[i]
+		fmt.Printf("Variation %d: %s\n", i+1, v.label())
+		fmt.Println("Prompt:", v.Prompt)
+		gens, err := generateImages(ctx, outputs, imageModelName, v.Prompt, imgConfig)
+		if err != nil {
+			// Keep going: the other variations may not be filtered
+			fmt.Println("Error:", err)
+		}
+		for _, gen := range gens {
+			v.Images = append(v.Images, gen.Image)
+		}
+		fmt.Println()
+	}
+
+	//
+	// Compose the contact sheet, and the HTML index
+	//
+	sheetPath := filepath.Join(dir, "contact_sheet.png")
+	if err := writeContactSheet(sheetPath, dir, vars, int(imgConfig.NumberOfImages)); err != nil {
+		return err
+	}
+	fmt.Println("Wrote contact sheet", sheetPath)
+
+	indexPath := filepath.Join(dir, "index.html")
+	f, err := os.Create(indexPath)
+	if err != nil {
+		return err
+	}
+	err = variationsIndex.Execute(f, map[string]any{
+		"BasePrompt": *basePrompt,
+		"Variations": vars,
+	})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Println("Wrote index", indexPath)
+
+	return nil
+}
+
+// writeContactSheet draws one row per variation, with its label and its
+// images as thumbnails.
+func writeContactSheet(path string, dir string, vars []promptVariation, columns int) error {
+	const (
+		thumb   = 256
+		margin  = 8
+		labelH  = 18
+		rowH    = labelH + thumb + margin
+		columnW = thumb + margin
+	)
+	sheet := image.NewRGBA(image.Rect(0, 0, margin+columns*columnW, margin+len(vars)*rowH))
+	xdraw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, xdraw.Src)
+
+	for row, v := range vars {
+		top := margin + row*rowH
+		c := palette[row%len(palette)]
+		drawLabel(sheet, image.Pt(margin, top), fmt.Sprintf("%d. %s", row+1, v.label()), c)
+		for col, name := range v.Images {
+			if col >= columns {
+				break
+			}
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			img, err := decodeImage(data)
+			if err != nil {
+				return err
+			}
+			cell := image.Rect(0, 0, thumb, thumb).Add(image.Pt(margin+col*columnW, top+labelH))
+			xdraw.CatmullRom.Scale(sheet, fitInside(img.Bounds(), cell), img, img.Bounds(), xdraw.Src, nil)
+		}
+		if len(v.Images) == 0 {
+			cell := image.Rect(0, 0, thumb, thumb).Add(image.Pt(margin, top+labelH))
+			drawLabel(sheet, cell.Min.Add(image.Pt(margin, margin)), "(no image)", color.Gray{Y: 128})
+		}
+	}
+	return writePNG(path, sheet)
+}
+
+// fitInside returns the largest rectangle with the aspect ratio of src,
+// centered in cell.
+func fitInside(src, cell image.Rectangle) image.Rectangle {
+	w, h := cell.Dx(), cell.Dy()
+	if src.Dx()*h > src.Dy()*w {
+		h = src.Dy() * w / src.Dx()
+	} else {
+		w = src.Dx() * h / src.Dy()
+	}
+	topLeft := cell.Min.Add(image.Pt((cell.Dx()-w)/2, (cell.Dy()-h)/2))
+	return image.Rectangle{Min: topLeft, Max: topLeft.Add(image.Pt(w, h))}
+}
+
+var variationsIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset='utf-8'>
+    <title>Variations of {{.BasePrompt}}</title>
+    <style>
+        body { font-family: sans-serif; }
+        img { width: 256px; margin: 4px; }
+    </style>
+</head>
+<body>
+    <h1>{{.BasePrompt}}</h1>
+    <p><a href='contact_sheet.png'>Contact sheet</a></p>
+    {{range $i, $v := .Variations}}
+    <h2>{{$v.Style}} / {{$v.Lighting}} / {{$v.Composition}}</h2>
+    <p>{{$v.Prompt}}</p>
+    {{range $v.Images}}<a href='{{.}}'><img src='{{.}}'></a>{{else}}<p>(no image)</p>{{end}}
+    {{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// To run this sample with a VertexAI Google Cloud project:
+//
+// $ export GOOGLE_GENAI_USE_VERTEXAI=true
+// $ export GOOGLE_CLOUD_PROJECT=xxxxxxxxx
+// $ export GOOGLE_CLOUD_LOCATION=us-central1
+// $ gcloud auth application-default login
+// $ gcloud services enable aiplatform.googleapis.com
+// $ go run . -n=15
+//
+// To evaluate your own prompts:
+//
+// $ go run . -n=15 -eval-prompt="A red umbrella with 3 yellow stars, on a snowy beach, at dusk"
+
+var evalPrompts stringList
+
+func init() {
+	flag.Var(&evalPrompts, "eval-prompt", "sample 15: an image generation prompt to evaluate (repeatable)")
+}
+
+// requirementScore is the evaluation of one image against one requirement of the prompt.
+type requirementScore struct {
+	// Index is the number of the requirement in the list sent to the model, from 1.
+	Index       int    `json:"index"`
+	Requirement string `json:"requirement"`
+	Satisfied   bool   `json:"satisfied"`
+	// Score is between 0 and 10
+	Score   int    `json:"score"`
+	Comment string `json:"comment"`
+}
+
+// imageEvaluation is the evaluation of one generated image.
+type imageEvaluation struct {
+	Prompt       string
+	Image        string
+	Requirements []string
+	// Scores has one score per requirement, in the same order.
+	Scores []requirementScore
+}
+
+// total is the sum of the scores of all the requirements.
+func (e imageEvaluation) total() int {
+	total := 0
+	for _, s := range e.Scores {
+		total += s.Score
+	}
+	return total
+}
+
+// maxTotal is the max possible total score.
+func (e imageEvaluation) maxTotal() int {
+	return 10 * len(e.Requirements)
+}
+
+// rating is the total score relative to the max possible score, so that
+// images of prompts with different numbers of requirements can be ranked.
+func (e imageEvaluation) rating() float64 {
+	if len(e.Requirements) == 0 {
+		return 0
+	}
+	return float64(e.total()) / float64(e.maxTotal())
+}
+
+func sample15_evaluateImages(ctx context.Context) error {
+	textModelName := "gemini-2.5-flash"
+	imageModelName := "imagen-3.0-generate-002"
+
+	prompts := evalPrompts
+	if len(prompts) == 0 {
+		prompts = []string{
+			"Create an overly decorated umbrella.",
+			"A green umbrella with exactly 5 white polka dots, upside down on a wooden table, next to 2 oranges, under a bright window light.",
+		}
+	}
+
+	dir := filepath.Join(*outDir, time.Now().Format("20060102-150405")+"_eval")
+	outputs, err := newImageOutputs(dir)
+	if err != nil {
+		return err
+	}
+	config, err := imagesConfig()
+	if err != nil {
+		return err
+	}
+
+	var evaluations []imageEvaluation
+	for _, prompt := range prompts {
+		fmt.Println("Prompt:", prompt)
+
+		// 1. Extract the requirements of the prompt
+		requirements, err := extractRequirements(ctx, textModelName, prompt)
+		if err != nil {
+			return err
+		}
+		for _, req := range requirements {
+			fmt.Println("  Requirement:", req)
+		}
+
+		// 2. Generate the images (sample 5)
+		gens, err := generateImages(ctx, outputs, imageModelName, prompt, config)
+		if err != nil {
+			fmt.Println("Error:", err)
+			fmt.Println()
+			continue
+		}
+
+		// 3. Check each image against each requirement (sample 2)
+		for _, gen := range gens {
+			imgdata, err := os.ReadFile(filepath.Join(dir, gen.Image))
+			if err != nil {
+				return err
+			}
+			scores, err := scoreImage(ctx, textModelName, imgdata, requirements)
+			if err != nil {
+				return err
+			}
+			evaluations = append(evaluations, imageEvaluation{
+				Prompt:       prompt,
+				Image:        filepath.Join(dir, gen.Image),
+				Requirements: requirements,
+				Scores:       scores,
+			})
+		}
+		fmt.Println()
+	}
+
+	printEvaluationReport(evaluations)
+	return nil
+}
+
+// extractRequirements asks the model to split the prompt into a list of
+// individually checkable requirements.
+func extractRequirements(ctx context.Context, modelName string, prompt string) ([]string, error) {
+	question := "List the individual visual requirements of this image generation prompt. " +
+		"Each requirement must be short, and checkable by looking at the image.\n\n" +
+		"Prompt: " + prompt
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type:  genai.TypeArray,
+			Items: &genai.Schema{Type: genai.TypeString},
+		},
+	}
+	result, err := client.Models.GenerateContent(ctx, modelName, genai.Text(question), config)
+	if err != nil {
+		return nil, err
+	}
+	var requirements []string
+	if err := json.Unmarshal([]byte(textOf(result)), &requirements); err != nil {
+		return nil, fmt.Errorf("decoding requirements: %w", err)
+	}
+	return requirements, nil
+}
+
+// scoreImage asks a vision model whether the image satisfies each requirement.
+// It returns one score per requirement, in the same order.
+func scoreImage(ctx context.Context, modelName string, imgdata []byte, requirements []string) ([]requirementScore, error) {
+	var sb strings.Builder
+	sb.WriteString("Does this image satisfy each of the following numbered requirements? " +
+		"For each requirement, give its number, and a score between 0 (not at all) and 10 (perfectly).\n\n")
+	for i, req := range requirements {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, req)
+	}
+	multimodalPrompt := []*genai.Content{
+		{
+			Parts: []*genai.Part{
+				genai.NewPartFromBytes(imgdata, "image/jpeg"),
+				genai.NewPartFromText(sb.String()),
+			},
+		},
+	}
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"index":       {Type: genai.TypeInteger},
+					"requirement": {Type: genai.TypeString},
+					"satisfied":   {Type: genai.TypeBoolean},
+					"score":       {Type: genai.TypeInteger},
+					"comment":     {Type: genai.TypeString},
+				},
+				Required:         []string{"index", "requirement", "satisfied", "score"},
+				PropertyOrdering: []string{"index", "requirement", "satisfied", "score", "comment"},
+			},
+		},
+	}
+	result, err := client.Models.GenerateContent(ctx, modelName, multimodalPrompt, config)
+	if err != nil {
+		return nil, err
+	}
+	var scores []requirementScore
+	if err := json.Unmarshal([]byte(textOf(result)), &scores); err != nil {
+		return nil, fmt.Errorf("decoding scores: %w", err)
+	}
+	return matchScores(requirements, scores), nil
+}
+
+// matchScores returns the score of each requirement, matched by number, or
+// else by text. The requirements the model didn't score get 0, so that
+// omitting a failed requirement doesn't rank an image higher. The scores
+// are clamped to 0-10.
+func matchScores(requirements []string, scores []requirementScore) []requirementScore {
+	matched := make([]requirementScore, len(requirements))
+	found := make([]bool, len(requirements))
+	for _, s := range scores {
+		i := s.Index - 1
+		if i < 0 || i >= len(requirements) || found[i] {
+			i = slices.IndexFunc(requirements, func(req string) bool {
+				return strings.EqualFold(strings.TrimSpace(req), strings.TrimSpace(s.Requirement))
+			})
+			if i < 0 || found[i] {
+				continue
+			}
+		}
+		s.Index = i + 1
+		s.Requirement = requirements[i]
+		s.Score = max(0, min(10, s.Score))
+		matched[i] = s
+		found[i] = true
+	}
+	for i, req := range requirements {
+		if !found[i] {
+			matched[i] = requirementScore{Index: i + 1, Requirement: req, Comment: "not evaluated by the model"}
+		}
+	}
+	return matched
+}
+
+// printEvaluationReport prints the images, best rated first, with their score
+// for each requirement.
+func printEvaluationReport(evaluations []imageEvaluation) {
+	slices.SortStableFunc(evaluations, func(a, b imageEvaluation) int {
+		return cmp.Compare(b.rating(), a.rating())
+	})
+	fmt.Println("Ranking:")
+	fmt.Println()
+	for rank, e := range evaluations {
+		satisfied := 0
+		for _, s := range e.Scores {
+			if s.Satisfied {
+				satisfied++
+			}
+		}
+		fmt.Printf("%d. %s\n", rank+1, e.Image)
+		fmt.Printf("   score %d/%d, %d/%d requirements satisfied, prompt %q\n",
+			e.total(), e.maxTotal(), satisfied, len(e.Requirements), e.Prompt)
+		for _, s := range e.Scores {
+			mark := "✗"
+			if s.Satisfied {
+				mark = "✓"
+			}
+			fmt.Printf("   %s %2d  %s", mark, s.Score, s.Requirement)
+			if s.Comment != "" {
+				fmt.Printf(" (%s)", s.Comment)
+			}
+			fmt.Println()
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchScores(t *testing.T) {
+	requirements := []string{"A red umbrella", "A rainy street", "Night time"}
+	missing := func(i int) requirementScore {
+		return requirementScore{Index: i, Requirement: requirements[i-1], Comment: "not evaluated by the model"}
+	}
+	tests := []struct {
+		name   string
+		scores []requirementScore
+		want   []requirementScore
+	}{
+		{
+			name: "in order",
+			scores: []requirementScore{
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 9},
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+				{Index: 3, Requirement: "Night time", Score: 2},
+			},
+			want: []requirementScore{
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 9},
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+				{Index: 3, Requirement: "Night time", Score: 2},
+			},
+		},
+		{
+			name: "out of order",
+			scores: []requirementScore{
+				{Index: 3, Requirement: "Night time", Score: 2},
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 9},
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+			},
+			want: []requirementScore{
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 9},
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+				{Index: 3, Requirement: "Night time", Score: 2},
+			},
+		},
+		{
+			name: "missing",
+			scores: []requirementScore{
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+			},
+			want: []requirementScore{
+				missing(1),
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+				missing(3),
+			},
+		},
+		{
+			name: "duplicate index, matched by text",
+			scores: []requirementScore{
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 9},
+				{Index: 1, Requirement: " night TIME ", Score: 3},
+			},
+			want: []requirementScore{
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 9},
+				missing(2),
+				{Index: 3, Requirement: "Night time", Score: 3},
+			},
+		},
+		{
+			name: "duplicate requirement, first one wins",
+			scores: []requirementScore{
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+				{Index: 2, Requirement: "A rainy street", Score: 1},
+			},
+			want: []requirementScore{
+				missing(1),
+				{Index: 2, Requirement: "A rainy street", Satisfied: true, Score: 8},
+				missing(3),
+			},
+		},
+		{
+			name: "unknown index and text, scores clamped",
+			scores: []requirementScore{
+				{Index: 7, Requirement: "A dog", Score: 5},
+				{Index: 0, Requirement: "a red umbrella", Satisfied: true, Score: 12},
+				{Index: 3, Requirement: "Night time", Score: -1},
+			},
+			want: []requirementScore{
+				{Index: 1, Requirement: "A red umbrella", Satisfied: true, Score: 10},
+				missing(2),
+				{Index: 3, Requirement: "Night time", Score: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchScores(requirements, tt.scores)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matchScores:\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
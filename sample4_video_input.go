@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"log"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"google.golang.org/genai"
 )
@@ -12,6 +19,56 @@ import (
 //
 // $ export GOOGLE_API_KEY=xxxxxxxxxx
 // $ go run . -n=4
+//
+// To get one structured answer per question:
+//
+// $ go run . -n=4 -structured
+//
+// To ask your own questions, as text or as audio files, in any combination.
+// The questions are numbered in the command line order:
+//
+// $ go run . -n=4 -question-audio=./testdata/question_about_video.mp3 -question-text="Is it sunny?"
+
+var (
+	structuredAnswers = flag.Bool("structured", false, "sample 4: ask for one structured answer per question")
+	userQuestions     []question
+)
+
+func init() {
+	flag.Var(questionFlag{&userQuestions, false}, "question-text", "sample 4: a question about the video (repeatable)")
+	flag.Var(questionFlag{&userQuestions, true}, "question-audio", "sample 4: path of an audio file containing a question about the video (repeatable)")
+}
+
+// questionFlag is a flag.Value that appends the text or audio questions to
+// the same list, to keep the command line order of mixed flags.
+type questionFlag struct {
+	questions *[]question
+	audio     bool
+}
+
+func (f questionFlag) String() string {
+	if f.questions == nil {
+		return ""
+	}
+	var values []string
+	for _, q := range *f.questions {
+		if q.isAudio() == f.audio {
+			values = append(values, q.Text+q.AudioPath)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (f questionFlag) Set(value string) error {
+	q := question{ID: fmt.Sprintf("q%d", len(*f.questions)+1)}
+	if f.audio {
+		q.AudioPath = value
+	} else {
+		q.Text = value
+	}
+	*f.questions = append(*f.questions, q)
+	return nil
+}
 
 func sample4_videoInput(ctx context.Context) error {
 	modelName := "gemini-2.5-flash-lite"
@@ -25,6 +82,36 @@ func sample4_videoInput(ctx context.Context) error {
 	question1 := "How many people are in this video?"
 	question2 := "In which country was this video filmed?"
 	question3 := "Are there animals in this video?"
+
+	var questions []question
+	switch {
+	case len(userQuestions) > 0:
+		questions = userQuestions
+		for i, q := range questions {
+			if q.AudioPath == "" {
+				continue
+			}
+			if questions[i].Audio, questions[i].AudioMIMEType, err = readAudio(q.AudioPath); err != nil {
+				return err
+			}
+		}
+	case *structuredAnswers:
+		questions = []question{
+			{ID: "q1", Text: question1},
+			{ID: "q2", Text: question2},
+			{ID: "q3", Text: question3},
+		}
+	}
+	if questions != nil {
+		video := genai.NewPartFromBytes(videodata, "video/mp4")
+		answers, err := askQuestions(ctx, modelName, []*genai.Part{video}, questions)
+		if err != nil {
+			return err
+		}
+		printAnswers(questions, answers)
+		return nil
+	}
+
 	fmt.Println("Question 1:", question1)
 	fmt.Println("Question 2:", question2)
 	fmt.Println("Question 3:", question3)
@@ -48,10 +135,146 @@ func sample4_videoInput(ctx context.Context) error {
 	fmt.Println("Answers:", answers)
 	fmt.Println()
 
-	//
-	// Exercise:
-	// instead of a text question, provide the audio file ./testdata/question_about_video.mp3 as the question.
-	//
-
 	return nil
 }
+
+// question is one of several questions sent in the same prompt.
+// The ID lets us match each answer with its question.
+//
+// A question is either a Text, or an Audio recording of someone asking it.
+type question struct {
+	ID            string
+	Text          string
+	AudioPath     string
+	Audio         []byte
+	AudioMIMEType string
+}
+
+func (q question) isAudio() bool {
+	return q.AudioPath != ""
+}
+
+// readAudio reads an audio file, and detects its MIME type from its
+// extension, or else from its content.
+func readAudio(path string) ([]byte, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(mimeType); !strings.HasPrefix(mediaType, "audio/") {
+		return nil, "", fmt.Errorf("%s is not an audio file (%s)", path, mimeType)
+	}
+	return data, mimeType, nil
+}
+
+// answer is the structured answer of the model to a single question.
+type answer struct {
+	// Transcription is the text of an audio question, as heard by the model.
+	Transcription string `json:"transcription,omitempty"`
+	Answer        string `json:"answer"`
+	// Confidence is between 0.0 and 1.0
+	Confidence float64 `json:"confidence"`
+	// EvidenceTimestamp is the position in the media (e.g. "00:42")
+	// that supports the answer, if any.
+	EvidenceTimestamp string `json:"evidence_timestamp"`
+}
+
+// askQuestions sends the media parts followed by all the questions in a single
+// prompt, and asks the model for a JSON object mapping each question ID to
+// its answer.
+//
+// Audio questions are transcribed by the model before being answered.
+//
+// The returned map may lack some IDs, if the model left some questions unanswered.
+func askQuestions(ctx context.Context, modelName string, media []*genai.Part, questions []question) (map[string]answer, error) {
+	answerSchema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"answer":             {Type: genai.TypeString},
+			"confidence":         {Type: genai.TypeNumber, Description: "between 0.0 and 1.0"},
+			"evidence_timestamp": {Type: genai.TypeString, Description: "MM:SS position in the media supporting the answer"},
+		},
+		Required:         []string{"answer", "confidence"},
+		PropertyOrdering: []string{"answer", "confidence", "evidence_timestamp"},
+	}
+	// Audio questions additionally require their transcription
+	audioAnswerSchema := &genai.Schema{
+		Type:             genai.TypeObject,
+		Properties:       map[string]*genai.Schema{"transcription": {Type: genai.TypeString}},
+		Required:         append([]string{"transcription"}, answerSchema.Required...),
+		PropertyOrdering: append([]string{"transcription"}, answerSchema.PropertyOrdering...),
+	}
+	for k, v := range answerSchema.Properties {
+		audioAnswerSchema.Properties[k] = v
+	}
+
+	schema := &genai.Schema{
+		Type:       genai.TypeObject,
+		Properties: map[string]*genai.Schema{},
+	}
+
+	parts := append([]*genai.Part{}, media...)
+	parts = append(parts, genai.NewPartFromText("Answer each of the following questions. Use the question ID as the key of its answer. "+
+		"Some questions are audio recordings: first transcribe them, then answer them."))
+	for _, q := range questions {
+		schema.PropertyOrdering = append(schema.PropertyOrdering, q.ID)
+		if q.isAudio() {
+			schema.Properties[q.ID] = audioAnswerSchema
+			parts = append(parts,
+				genai.NewPartFromText(q.ID+" (audio question):"),
+				genai.NewPartFromBytes(q.Audio, q.AudioMIMEType))
+		} else {
+			schema.Properties[q.ID] = answerSchema
+			parts = append(parts, genai.NewPartFromText(q.ID+": "+q.Text))
+		}
+	}
+
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   schema,
+	}
+	prompt := []*genai.Content{{Parts: parts}}
+	result, err := client.Models.GenerateContent(ctx, modelName, prompt, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var answers map[string]answer
+	if err := json.Unmarshal([]byte(textOf(result)), &answers); err != nil {
+		return nil, fmt.Errorf("decoding structured answers: %w", err)
+	}
+	return answers, nil
+}
+
+// printAnswers prints each answer next to its question, and warns about
+// the questions left unanswered.
+func printAnswers(questions []question, answers map[string]answer) {
+	unanswered := 0
+	for _, q := range questions {
+		a, ok := answers[q.ID]
+		if q.isAudio() {
+			fmt.Printf("Question %s: (audio %s) %s\n", q.ID, q.AudioPath, a.Transcription)
+		} else {
+			fmt.Printf("Question %s: %s\n", q.ID, q.Text)
+		}
+		if !ok || a.Answer == "" {
+			fmt.Println("Answer: (none)")
+			fmt.Println()
+			unanswered++
+			continue
+		}
+		fmt.Println("Answer:", a.Answer)
+		fmt.Printf("Confidence: %.2f\n", a.Confidence)
+		if a.EvidenceTimestamp != "" {
+			fmt.Println("Evidence at:", a.EvidenceTimestamp)
+		}
+		fmt.Println()
+	}
+	if unanswered > 0 {
+		log.Printf("Warning: %d question(s) out of %d left unanswered", unanswered, len(questions))
+	}
+}
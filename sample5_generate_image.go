@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"os"
+	"path/filepath"
+	"slices"
+	"time"
 
 	"google.golang.org/genai"
 )
@@ -16,30 +19,160 @@ import (
 // $ gcloud auth application-default login
 // $ gcloud services enable aiplatform.googleapis.com
 // $ go run . -n=5
+//
+// To list the images generated by the previous runs:
+//
+// $ go run . -n=5 -list
+//
+// To tune the safety filters and the generation settings:
+//
+// $ go run . -n=5 -safety-filter=BLOCK_ONLY_HIGH -person-generation=ALLOW_ADULT -aspect-ratio=16:9
+//
+// To generate reproducible images, and later check that they are reproduced:
+//
+// $ go run . -n=5 -seed=42 -watermark=false
+// $ go run . -n=5 -reproduce=generated_images/20261019-101500-042_create-an-overly-decorated-umbrella_0.json
+
+var (
+	outDir          = flag.String("out", "generated_images", "samples 5+: directory of the generated images and their metadata")
+	listGenerations = flag.Bool("list", false, "sample 5: list the previously generated images")
+
+	safetyFilterLevel = flag.String("safety-filter", "", "image generation: BLOCK_LOW_AND_ABOVE, BLOCK_MEDIUM_AND_ABOVE, BLOCK_ONLY_HIGH or BLOCK_NONE")
+	personGeneration  = flag.String("person-generation", "", "image generation: DONT_ALLOW, ALLOW_ADULT or ALLOW_ALL")
+	negativePrompt    = flag.String("negative-prompt", "", "image generation: what to discourage in the images")
+	aspectRatio       = flag.String("aspect-ratio", "", "image generation: 1:1, 3:4, 4:3, 9:16 or 16:9")
+	promptLanguage    = flag.String("language", "", "image generation: language of the prompt, e.g. auto, en, ja, ko, hi, zh, pt, es")
+	seed              = flag.Int("seed", -1, "image generation: seed for reproducible images, requires -watermark=false (-1 for none)")
+	watermark         = flag.Bool("watermark", true, "image generation: add an invisible watermark to the images")
+	reproduce         = flag.String("reproduce", "", "sample 5: path of a JSON sidecar file, to re-run its generation and compare the images")
+)
+
+// aspectRatios are the aspect ratios supported by the image generation models.
+var aspectRatios = []string{"1:1", "3:4", "4:3", "9:16", "16:9"}
+
+// imagesConfig returns the image generation settings, with the values of the
+// command line flags.
+func imagesConfig() (*genai.GenerateImagesConfig, error) {
+	config := &genai.GenerateImagesConfig{
+		NumberOfImages:    4,
+		OutputMIMEType:    "image/jpeg",
+		IncludeRAIReason:  true,
+		SafetyFilterLevel: genai.SafetyFilterLevel(*safetyFilterLevel),
+		PersonGeneration:  genai.PersonGeneration(*personGeneration),
+		NegativePrompt:    *negativePrompt,
+		AspectRatio:       *aspectRatio,
+		Language:          genai.ImagePromptLanguage(*promptLanguage),
+	}
+	if err := checkOneOf("safety-filter", *safetyFilterLevel,
+		genai.SafetyFilterLevelBlockLowAndAbove,
+		genai.SafetyFilterLevelBlockMediumAndAbove,
+		genai.SafetyFilterLevelBlockOnlyHigh,
+		genai.SafetyFilterLevelBlockNone); err != nil {
+		return nil, err
+	}
+	if err := checkOneOf("person-generation", *personGeneration,
+		genai.PersonGenerationDontAllow,
+		genai.PersonGenerationAllowAdult,
+		genai.PersonGenerationAllowAll); err != nil {
+		return nil, err
+	}
+	if err := checkOneOf("aspect-ratio", *aspectRatio, aspectRatios...); err != nil {
+		return nil, err
+	}
+	if *seed >= 0 {
+		if *watermark {
+			return nil, fmt.Errorf("the flag -seed requires -watermark=false")
+		}
+		config.Seed = genai.Ptr(int32(*seed))
+	}
+	setWatermark(config, *watermark)
+	return config, nil
+}
+
+// setWatermark enables or disables the watermark of the generated images.
+//
+// The server adds a watermark by default, and the SDK omits AddWatermark
+// when it is false, so disabling it needs an explicit parameter in the
+// request body. Only Vertex AI supports this parameter.
+func setWatermark(config *genai.GenerateImagesConfig, enabled bool) {
+	config.AddWatermark = enabled
+	if enabled {
+		config.HTTPOptions = nil
+		return
+	}
+	config.HTTPOptions = &genai.HTTPOptions{
+		ExtraBody: map[string]any{
+			"parameters": map[string]any{"addWatermark": false},
+		},
+	}
+}
+
+// checkOneOf returns an error if the flag value is set, and is not one of the allowed values.
+func checkOneOf[S ~string](flagName string, value string, allowed ...S) error {
+	if value == "" || slices.Contains(allowed, S(value)) {
+		return nil
+	}
+	return fmt.Errorf("invalid value %q for flag -%s, expected one of %v", value, flagName, allowed)
+}
+
+// reportFiltered prints the reason of each image filtered out by the safety
+// filters, and returns the number of filtered images.
+func reportFiltered(images []*genai.GeneratedImage) int {
+	filtered := 0
+	for i, img := range images {
+		if isFiltered(img) {
+			filtered++
+			reason := img.RAIFilteredReason
+			if reason == "" {
+				reason = "(no reason given)"
+			}
+			fmt.Printf("Image %d was filtered: %s\n", i, reason)
+		}
+	}
+	if filtered > 0 {
+		fmt.Printf("%d image(s) out of %d filtered by the safety filters\n", filtered, len(images))
+		fmt.Println()
+	}
+	return filtered
+}
+
+// isFiltered tells if the image was blocked by the Responsible AI filters.
+func isFiltered(img *genai.GeneratedImage) bool {
+	return img.Image == nil || len(img.Image.ImageBytes) == 0 || img.RAIFilteredReason != ""
+}
 
 func sample5_generateImage(ctx context.Context) error {
+	outputs, err := newImageOutputs(*outDir)
+	if err != nil {
+		return err
+	}
+	if *listGenerations {
+		gens, err := outputs.list()
+		if err != nil {
+			return err
+		}
+		printGenerations(gens)
+		return nil
+	}
+	if *reproduce != "" {
+		return reproduceGeneration(ctx, outputs, *reproduce)
+	}
+
 	modelName := "imagen-3.0-generate-002"
 	prompt := "Create an overly decorated umbrella."
 	fmt.Println("Prompt:", prompt)
 	fmt.Println()
 
-	var config *genai.GenerateImagesConfig = &genai.GenerateImagesConfig{
-		NumberOfImages:   4,
-		OutputMIMEType:   "image/jpeg",
-		IncludeRAIReason: true,
+	config, err := imagesConfig()
+	if err != nil {
+		return err
 	}
-	result, err := client.Models.GenerateImages(ctx, modelName, prompt, config)
+	gens, err := generateImages(ctx, outputs, modelName, prompt, config)
 	if err != nil {
 		return err
 	}
-
-	for i, img := range result.GeneratedImages {
-		path := fmt.Sprintf("generated_image_%d.jpg", i)
-		fmt.Println("Writing image to file", path)
-		err := os.WriteFile(path, img.Image.ImageBytes, 0777)
-		if err != nil {
-			return err
-		}
+	for _, gen := range gens {
+		fmt.Println("Wrote image to file", filepath.Join(outputs.dir, gen.Image))
 	}
 
 	//
@@ -50,3 +183,91 @@ func sample5_generateImage(ctx context.Context) error {
 
 	return nil
 }
+
+// generateImages generates images, reports the filtered ones, and saves
+// the others into outputs. It returns the metadata of the saved images.
+func generateImages(ctx context.Context, outputs *imageOutputs, modelName string, prompt string, config *genai.GenerateImagesConfig) ([]generation, error) {
+	result, err := client.Models.GenerateImages(ctx, modelName, prompt, config)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.GeneratedImages) == 0 {
+		return nil, fmt.Errorf("no image generated: they may all have been filtered")
+	}
+	reportFiltered(result.GeneratedImages)
+
+	var gens []generation
+	now := time.Now()
+	for i, img := range result.GeneratedImages {
+		if isFiltered(img) {
+			continue
+		}
+		gen := generation{
+			Time:              now,
+			Index:             i,
+			Prompt:            prompt,
+			EnhancedPrompt:    img.EnhancedPrompt,
+			Model:             modelName,
+			Config:            config,
+			Seed:              config.Seed,
+			RAIFilteredReason: img.RAIFilteredReason,
+			Backend:           client.ClientConfig().Backend.String(),
+		}
+		path, err := outputs.save(img.Image, gen)
+		if err != nil {
+			return nil, err
+		}
+		gen.Image = filepath.Base(path)
+		gens = append(gens, gen)
+	}
+	return gens, nil
+}
+
+// reproduceGeneration runs again the generation recorded in the JSON sidecar
+// file, with identical settings, and compares the new images with the old ones.
+func reproduceGeneration(ctx context.Context, outputs *imageOutputs, sidecarPath string) error {
+	oldOutputs := &imageOutputs{dir: filepath.Dir(sidecarPath)}
+	old, err := oldOutputs.load(filepath.Base(sidecarPath))
+	if err != nil {
+		return err
+	}
+	if old.Seed == nil {
+		fmt.Println("Warning: the original generation had no seed, the images are not expected to be identical")
+	}
+
+	// All the images of the same run share the same time and prompt
+	oldGens, err := oldOutputs.list()
+	if err != nil {
+		return err
+	}
+	oldByIndex := map[int]generation{}
+	for _, gen := range oldGens {
+		if gen.Time.Equal(old.Time) && gen.Prompt == old.Prompt {
+			oldByIndex[gen.Index] = gen
+		}
+	}
+
+	fmt.Println("Reproducing:", old.Prompt)
+	fmt.Println("Model:", old.Model)
+	fmt.Println()
+	gens, err := generateImages(ctx, outputs, old.Model, old.Prompt, old.Config)
+	if err != nil {
+		return err
+	}
+
+	for _, gen := range gens {
+		oldGen, ok := oldByIndex[gen.Index]
+		if !ok {
+			fmt.Printf("Image %d: %s (no previous image to compare)\n", gen.Index, gen.Image)
+			continue
+		}
+		cmp, err := compareImageFiles(
+			filepath.Join(oldOutputs.dir, oldGen.Image),
+			filepath.Join(outputs.dir, gen.Image))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Image %d: %s vs %s: %s\n", gen.Index, oldGen.Image, gen.Image, cmp)
+	}
+	return nil
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"flag"
 	"fmt"
+	"image"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 
 	"google.golang.org/genai"
 )
@@ -16,34 +24,179 @@ import (
 // $ gcloud auth application-default login
 // $ gcloud services enable aiplatform.googleapis.com
 // $ go run . -n=6
+//
+// To upscale several files, or all the images of a directory:
+//
+// $ go run . -n=6 -factor=x2 ./testdata/pool.png ./testdata/forbiddenwords
+
+var (
+	upscaleFactor   = flag.String("factor", "x4", "sample 6: upscale factor, x2 or x4")
+	upscaleParallel = flag.Int("parallel", 4, "sample 6: max number of images upscaled concurrently")
+)
+
+// maxUpscaledPixels is the max size of the output of the upscale model.
+const maxUpscaledPixels = 17_000_000
 
 func sample6_upscaleImage(ctx context.Context) error {
 	modelName := "imagen-3.0-generate-002"
+	if scaleOf(*upscaleFactor) == 0 {
+		return fmt.Errorf("invalid upscale factor %q, expected x2 or x4", *upscaleFactor)
+	}
 
-	imgdata, err := os.ReadFile("./testdata/lion.jpg")
+	paths, err := imagePaths(flag.Args())
 	if err != nil {
 		return err
 	}
+	if len(paths) == 0 {
+		paths = []string{"./testdata/lion.jpg"}
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
 
+	// Upscale at most *upscaleParallel images at the same time
+	sem := make(chan struct{}, max(*upscaleParallel, 1))
+	reports := make([]string, len(paths))
+	errs := make([]error, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			reports[i], errs[i] = upscaleFile(ctx, modelName, path, *upscaleFactor)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, path := range paths {
+		if errs[i] != nil {
+			fmt.Printf("%s: %v\n", path, errs[i])
+			failed++
+			continue
+		}
+		fmt.Printf("%s: %s\n", path, reports[i])
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d image(s) out of %d could not be upscaled", failed, len(paths))
+	}
+	return nil
+}
+
+// upscaleFile upscales the image file into the output directory, and returns
+// a report of the input and output dimensions.
+func upscaleFile(ctx context.Context, modelName string, path string, factor string) (string, error) {
+	imgdata, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	in, err := checkUpscale(imgdata, factor)
+	if err != nil {
+		return "", err
+	}
+
+	upscaled, err := upscaleImage(ctx, modelName, imgdata, http.DetectContentType(imgdata), factor)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the actual scale of the output
+	out, _, err := image.DecodeConfig(bytes.NewReader(upscaled))
+	if err != nil {
+		return "", fmt.Errorf("decoding upscaled image: %w", err)
+	}
+	report := fmt.Sprintf("%dx%d -> %dx%d", in.Width, in.Height, out.Width, out.Height)
+	if n := scaleOf(factor); out.Width != n*in.Width || out.Height != n*in.Height {
+		report += fmt.Sprintf(" (warning: expected %dx%d)", n*in.Width, n*in.Height)
+	}
+
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, filepath.Ext(base)) + "_upscaled_" + factor
+	name, err := writeUniqueFile(*outDir, base, ".jpg", upscaled)
+	if err != nil {
+		return "", err
+	}
+	return report + ", written to " + filepath.Join(*outDir, name), nil
+}
+
+// upscaleImage returns the JPEG data of the image upscaled by factor ("x2" or "x4").
+// The caller is expected to validate the image first with checkUpscale.
+func upscaleImage(ctx context.Context, modelName string, imgdata []byte, mimeType string, factor string) ([]byte, error) {
 	var config *genai.UpscaleImageConfig = &genai.UpscaleImageConfig{
 		OutputMIMEType:   "image/jpeg",
 		IncludeRAIReason: true,
 	}
 	image := &genai.Image{
 		ImageBytes: imgdata,
-		MIMEType:   "image/jpeg",
+		MIMEType:   mimeType,
 	}
-	result, err := client.Models.UpscaleImage(ctx, modelName, image, "x4", config)
+	result, err := client.Models.UpscaleImage(ctx, modelName, image, factor, config)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(result.GeneratedImages) == 0 {
+		return nil, fmt.Errorf("no upscaled image returned")
 	}
+	if img := result.GeneratedImages[0]; isFiltered(img) {
+		return nil, fmt.Errorf("upscaled image filtered: %s", img.RAIFilteredReason)
+	}
+	return result.GeneratedImages[0].Image.ImageBytes, nil
+}
 
-	path := fmt.Sprintf("upscaled_image.jpg")
-	fmt.Println("Writing file", path)
-	err = os.WriteFile(path, result.GeneratedImages[0].Image.ImageBytes, 0777)
+// checkUpscale validates the factor, and the dimensions of the image against
+// the limits of the model, before calling it.
+func checkUpscale(imgdata []byte, factor string) (image.Config, error) {
+	n := scaleOf(factor)
+	if n == 0 {
+		return image.Config{}, fmt.Errorf("invalid upscale factor %q, expected x2 or x4", factor)
+	}
+	in, _, err := image.DecodeConfig(bytes.NewReader(imgdata))
 	if err != nil {
-		return err
+		return in, fmt.Errorf("decoding image: %w", err)
+	}
+	if outPixels := n * in.Width * n * in.Height; outPixels > maxUpscaledPixels {
+		return in, fmt.Errorf("image %dx%d is too large to upscale %s: %d pixels, max %d",
+			in.Width, in.Height, factor, outPixels, maxUpscaledPixels)
 	}
+	return in, nil
+}
 
-	return nil
+// scaleOf returns 2 for "x2", 4 for "x4", and 0 for invalid factors.
+func scaleOf(factor string) int {
+	switch factor {
+	case "x2":
+		return 2
+	case "x4":
+		return 4
+	default:
+		return 0
+	}
+}
+
+// imagePaths expands the directories in args into the image files they contain.
+func imagePaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && slices.Contains([]string{".jpg", ".jpeg", ".png"}, ext) {
+				paths = append(paths, filepath.Join(arg, entry.Name()))
+			}
+		}
+	}
+	return paths, nil
 }
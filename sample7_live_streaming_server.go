@@ -2,16 +2,15 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"io"
 	"log"
+	"maps"
 	"net/http"
-	"os"
+	"slices"
 	"text/template"
 
 	_ "embed"
 
-	"github.com/gorilla/websocket"
 	"google.golang.org/genai"
 )
 
@@ -24,170 +23,66 @@ import (
 func sample7_liveStreamingServer(ctx context.Context) error {
 	log.SetFlags(0)
 	http.HandleFunc("/", homePage)
-	http.HandleFunc("/live", live)
+	// The model can call these functions, which run on the server
+	liveProxy.Tools = []LiveTool{currentTimeTool, jsonLookupTool(*lookupFile)}
+	liveProxy.applyFlags()
+	http.Handle("/live", liveProxy)
 	http.HandleFunc("/proxyVideo", proxyVideo)
 
-	// Determine port for HTTP service.
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-		log.Printf("defaulting to port %s", port)
-	}
-
-	// Start HTTP server.
-	log.Printf("listening on port %s", port)
-	return http.ListenAndServe(":"+port, nil)
+	return serveLive(ctx, liveProxy)
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allows connections from any origin
-		// This help with testing in Cloud Shell,
-		// however we should not do this in a production system.
-		return true
+// liveProxy proxies the browser audio and video to the Live API,
+// and the model responses back to the browser.
+var liveProxy = &LiveProxy{
+	// Only the allowed origins, see -allowed-origins
+	Upgrader: liveUpgrader(),
+	Config:   liveConfig,
+	OnInputTranscript: func(s *LiveSession, text string) {
+		log.Printf("Input Transcript: %s", text)
+	},
+	OnOutputTranscript: func(s *LiveSession, text string) {
+		log.Printf("Output Transcript: %s", text)
 	},
 }
 
 //go:embed sample7_live_streaming.html
 var homeTemplate string
 
-// live handles incoming WebSocket requests for the live streaming example.
-// It upgrades the HTTP connection to a WebSocket connection, establishes a
-// connection with the configured GenAI model (Gemini API or Vertex AI),
-// and then proxies messages between the client WebSocket and the GenAI service.
-// It runs two goroutines: one to receive messages from the GenAI service and
-// forward them to the client, and another to read messages from the client
-// and send them to the GenAI service.
-func live(w http.ResponseWriter, r *http.Request) {
-	// Attempt to upgrade the HTTP connection to a WebSocket connection.
-	c, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		// Log fatal error if the WebSocket upgrade fails (e.g., invalid request headers).
-		log.Fatal("upgrade error: ", err)
-		return
-	}
-	defer c.Close()
+// livePersonas are the system instructions that the browser can choose.
+var livePersonas = map[string]string{
+	"":        "",
+	"german":  "Always answer in German, only in German.",
+	"tutor":   "You are a patient tutor. Explain step by step, and check that the student understood before going further.",
+	"concise": "Answer in one or two short sentences.",
+	"greeter": "Start the conversation by greeting Marc and Valentin.",
+}
 
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, nil)
+// liveConfig returns the configuration of the live sessions of sample 7,
+// with the setup chosen in the browser, e.g.
+//
+//	/live?voice=Puck&modality=audio&persona=tutor&transcription=true
+func liveConfig(r *http.Request, model string) (*genai.LiveConnectConfig, error) {
+	setup, err := parseLiveSetup(r.URL.Query())
 	if err != nil {
-		// Log fatal error if client creation fails (e.g., invalid config, authentication issues).
-		log.Fatal("create client error: ", err)
-		return
+		return nil, err
 	}
+	return setup.config(model, livePersonas)
+}
 
+// liveModel returns the Live API model to use with the backend.
+func liveModel(backend genai.Backend) string {
 	// NOTE: Model IDs are subject to change. Always consult the official
 	// Google Cloud Vertex AI and Google AI Studio Gemini model documentation for the latest versions.
-	var model string
-	if client.ClientConfig().Backend == genai.BackendVertexAI {
-		// Use the latest Vertex AI Live API model with Native Audio Preview (as of Oct 2025)
-		model = "gemini-live-2.5-flash-preview-native-audio-09-2025"
-	} else {
-		// Use the latest Gemini API (Google AI Studio) model with Native Audio Preview (as of Oct 2025)
-		// This replaces the soon-to-be-discontinued 'gemini-live-2.5-flash-preview'.
-		model = "gemini-2.5-flash-native-audio-preview-09-2025"
-	}
 	// TODO: Consider updating to the Generally Available (GA) version of the
 	// Live API Native Audio models when they are released (expected Nov 2025).
-
-	// Establish the live WebSocket connection with the specified GenAI model.
-	config := &genai.LiveConnectConfig{} // empty config
-	config.SystemInstruction = &genai.Content{
-		Parts: []*genai.Part{
-			// {Text: "Always answer in German, only in German."},
-			// {Text: "Start the conversation by greeting Marc and Valentin."},
-		},
-	}
-	// voiceName := "Zephyr"
-	// voiceName := "Gacrux" // not available for model models/gemini-live-2.5-flash-preview
-	// voiceName := "Achird" // not available for model models/gemini-live-2.5-flash-preview
-	// voiceName := "Kore" // very very asian
-	// config.SpeechConfig = &genai.SpeechConfig{
-	// 	VoiceConfig: &genai.VoiceConfig{
-	// 		PrebuiltVoiceConfig: &genai.PrebuiltVoiceConfig{
-	// 			VoiceName: voiceName,
-	// 		},
-	// 	},
-	// }
-	config.ResponseModalities = []genai.Modality{genai.ModalityAudio}
-	//config.ResponseModalities = []genai.Modality{genai.ModalityAudio, genai.ModalityText}
-	// config.ResponseModalities = []genai.Modality{genai.ModalityText, genai.ModalityAudio}
-	// config.ResponseModalities = []genai.Modality{genai.ModalityText}
-	config.InputAudioTranscription = &genai.AudioTranscriptionConfig{}
-	config.OutputAudioTranscription = &genai.AudioTranscriptionConfig{}
-	session, err := client.Live.Connect(ctx, model, config)
-	if err != nil {
-		// Log fatal error if connecting to the model fails (e.g., network issues, invalid model name).
-		log.Fatal("connect to model error: ", err)
-	}
-	defer session.Close() // Ensure session is closed when the handler exits
-
-	// Goroutine to receive messages from the GenAI service and send to the client
-	go func() {
-		for {
-			// Receive the next message from the GenAI service session.
-			message, err := session.Receive()
-			if err != nil {
-				// Log fatal error if receiving from the GenAI service fails (e.g., connection closed, network error).
-				log.Fatal("receive model response error: ", err)
-			}
-			if message.ServerContent != nil {
-				if message.ServerContent.InputTranscription != nil && message.ServerContent.InputTranscription.Text != "" {
-					log.Printf("Input Transcript: %s", message.ServerContent.InputTranscription.Text)
-				}
-				if message.ServerContent.OutputTranscription != nil && message.ServerContent.OutputTranscription.Text != "" {
-					log.Printf("Output Transcript: %s", message.ServerContent.OutputTranscription.Text)
-				}
-			}
-			// Marshal the received message into JSON format.
-			messageBytes, err := json.Marshal(message)
-			if err != nil {
-				// Log fatal error if marshaling the message to JSON fails.
-				log.Fatal("marhal model response error: ", message, err)
-			}
-			{
-				tmpfile, err := os.CreateTemp("", "livestream")
-				if err != nil {
-					log.Fatalln(err)
-				}
-				//fmt.Printf("Received JSON from model, writing to %s\n", tmpfile.Name())
-				tmpfile.Write(messageBytes)
-				tmpfile.Close()
-			}
-			// Send the JSON message to the client WebSocket.
-			err = c.WriteMessage(websocket.TextMessage, messageBytes) // Use TextMessage type for JSON
-			if err != nil {
-				// Log error and break the loop if writing to the client WebSocket fails (e.g., client disconnected).
-				log.Println("write message error: ", err)
-				break
-			}
-		}
-	}()
-
-	// Main loop to read messages from the client and send to the GenAI service
-	for {
-		// Read the next message from the client WebSocket.
-		_, message, err := c.ReadMessage()
-		if err != nil {
-			// Log error and break the loop if reading from the client WebSocket fails (e.g., client disconnected).
-			log.Println("read from client error: ", err)
-			break // Exit loop on error
-		}
-		if len(message) > 0 {
-			// log.Printf(" bytes size received from client: %d", len(message))
-		}
-
-		var realtimeInput genai.LiveRealtimeInput
-		// Unmarshal the received client message into a LiveRealtimeInput struct.
-		if err := json.Unmarshal(message, &realtimeInput); err != nil {
-			// Log fatal error if unmarshaling the client message fails (e.g., invalid JSON format).
-			log.Fatal("unmarshal message error ", string(message), err)
-		}
-		// Send the unmarshaled realtime input to the GenAI service session.
-		// Note: This currently doesn't handle potential errors from SendRealtimeInput.
-		// Consider adding error handling here if needed.
-		session.SendRealtimeInput(realtimeInput)
-	}
+	return modelFor(backend,
+		// Use the latest Gemini API (Google AI Studio) model with Native Audio Preview (as of Oct 2025)
+		// This replaces the soon-to-be-discontinued 'gemini-live-2.5-flash-preview'.
+		"gemini-2.5-flash-native-audio-preview-09-2025",
+		// Use the latest Vertex AI Live API model with Native Audio Preview (as of Oct 2025)
+		"gemini-live-2.5-flash-preview-native-audio-09-2025",
+	)
 }
 
 func homePage(w http.ResponseWriter, r *http.Request) {
@@ -199,9 +94,21 @@ func homePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// fmt.Println("ws://" + r.Host + "/live")
-	// Execute the template, passing the WebSocket URL to it.
-	err = tmpl.Execute(w, "ws://"+r.Host+"/live")
+	// The setup options of the model, for the dropdowns of the page
+	backend := genai.BackendGeminiAPI
+	if client != nil {
+		backend = client.ClientConfig().Backend
+	} // else -replay: the setup is ignored anyway
+	model := liveModel(backend)
+	personas := slices.Sorted(maps.Keys(livePersonas))
+
+	// Execute the template, passing the WebSocket URL and the options to it.
+	err = tmpl.Execute(w, map[string]any{
+		"URL":      liveWebSocketURL(r),
+		"Model":    model,
+		"Options":  liveModelOptions[model],
+		"Personas": personas,
+	})
 	if err != nil {
 		// Return an internal server error if executing the template fails.
 		http.Error(w, "Error executing template", http.StatusInternalServerError)
@@ -2,15 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
-	"os"
 	"text/template"
 
 	_ "embed"
 
-	"github.com/gorilla/websocket"
 	"google.golang.org/genai"
 )
 
@@ -22,19 +19,11 @@ import (
 func sample8_forbiddenWords(ctx context.Context) error {
 	log.SetFlags(0)
 	http.HandleFunc("/", serveSample8Webapp)
-	http.HandleFunc("/live", sample8Live)
+	sample8Proxy.applyFlags()
+	http.Handle("/live", sample8Proxy)
 	http.Handle("/forbiddenwords/", http.StripPrefix("/forbiddenwords/", http.FileServer(http.Dir("testdata/forbiddenwords"))))
 
-	// Determine port for HTTP service.
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-		log.Printf("defaulting to port %s", port)
-	}
-
-	// Start HTTP server.
-	log.Printf("listening on port %s", port)
-	return http.ListenAndServe(":"+port, nil)
+	return serveLive(ctx, sample8Proxy)
 }
 
 const sample8Prompt = `
@@ -56,7 +45,7 @@ func serveSample8Webapp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Execute the template, passing the WebSocket URL to it.
-	err = tmpl.Execute(w, "ws://"+r.Host+"/live")
+	err = tmpl.Execute(w, liveWebSocketURL(r))
 	if err != nil {
 		// Return an internal server error if executing the template fails.
 		http.Error(w, "Error executing template", http.StatusInternalServerError)
@@ -64,47 +53,24 @@ func serveSample8Webapp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-var sample8Upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allows connections from any origin
-		// This help with testing in Cloud Shell,
-		// however we should not do this in a production system.
-		return true
+// sample8Proxy proxies the player audio to the Live API, and logs what the
+// human player says and what the model guesses.
+var sample8Proxy = &LiveProxy{
+	// Only the allowed origins, see -allowed-origins
+	Upgrader: liveUpgrader(),
+	Config:   sample8Config,
+	OnInputTranscript: func(s *LiveSession, text string) {
+		log.Printf("Human player says: %s", text)
+		log.Printf("Human player says buffer: %s", s.InputTranscript())
+	},
+	OnOutputTranscript: func(s *LiveSession, text string) {
+		log.Printf("Model player guesses: %s", text)
+		log.Printf("Model player guesses buffer: %s", s.OutputTranscript())
 	},
 }
 
-func sample8Live(w http.ResponseWriter, r *http.Request) {
-	// Attempt to upgrade the HTTP connection to a WebSocket connection.
-	c, err := sample8Upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		// Log fatal error if the WebSocket upgrade fails (e.g., invalid request headers).
-		log.Fatal("upgrade error: ", err)
-		return
-	}
-	defer c.Close()
-
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, nil)
-	if err != nil {
-		log.Fatal("create client error: ", err)
-		return
-	}
-
-	// NOTE: Model IDs are subject to change. Always consult the official
-	// Google Cloud Vertex AI and Google AI Studio Gemini model documentation for the latest versions.
-	var model string
-	if client.ClientConfig().Backend == genai.BackendVertexAI {
-		// Use the latest Vertex AI Live API model with Native Audio Preview (as of Oct 2025)
-		model = "gemini-live-2.5-flash-preview-native-audio-09-2025"
-	} else {
-		// Use the latest Gemini API (Google AI Studio) model with Native Audio Preview (as of Oct 2025)
-		// This replaces the soon-to-be-discontinued 'gemini-live-2.5-flash-preview'.
-		model = "gemini-2.5-flash-native-audio-preview-09-2025"
-	}
-	// TODO: Consider updating to the Generally Available (GA) version of the
-	// Live API Native Audio models when they are released (expected Nov 2025).
-
-	// Establish the live WebSocket connection with the specified GenAI model.
+// sample8Config returns the configuration of the live sessions of sample 8.
+func sample8Config(r *http.Request, model string) (*genai.LiveConnectConfig, error) {
 	config := &genai.LiveConnectConfig{} // empty config
 	config.SystemInstruction = &genai.Content{
 		Parts: []*genai.Part{
@@ -122,91 +88,5 @@ func sample8Live(w http.ResponseWriter, r *http.Request) {
 	config.ResponseModalities = []genai.Modality{genai.ModalityAudio}
 	config.InputAudioTranscription = &genai.AudioTranscriptionConfig{}
 	config.OutputAudioTranscription = &genai.AudioTranscriptionConfig{}
-	session, err := client.Live.Connect(ctx, model, config)
-	if err != nil {
-		// Log fatal error if connecting to the model fails (e.g., network issues, invalid model name).
-		log.Fatal("connect to model error: ", err)
-	}
-	defer session.Close() // Ensure session is closed when the handler exits
-
-	// Goroutine to receive messages from the GenAI service and send to the client
-	go func() {
-		var humanSpeechBuffer []byte
-		var modelGuessBuffer []byte
-		for {
-			// Receive the next message from the GenAI service session.
-			message, err := session.Receive()
-			if err != nil {
-				// Log fatal error if receiving from the GenAI service fails (e.g., connection closed, network error).
-				log.Println("deconnected: ", err)
-				// The conversation is now stopped, but avoid crashing
-				return
-			}
-			if message.ServerContent != nil {
-				if message.ServerContent.InputTranscription != nil {
-					inputText := message.ServerContent.InputTranscription.Text
-					if inputText != "" {
-						log.Printf("Human player says: %s", inputText)
-						humanSpeechBuffer = append(humanSpeechBuffer, inputText...)
-						log.Printf("Human player says buffer: %s", humanSpeechBuffer)
-					}
-				}
-				if message.ServerContent.OutputTranscription != nil {
-					outputText := message.ServerContent.OutputTranscription.Text
-					if outputText != "" {
-						modelGuessBuffer = append(modelGuessBuffer, outputText...)
-						log.Printf("Model player guesses: %s", outputText)
-						log.Printf("Model player guesses buffer: %s", modelGuessBuffer)
-					}
-				}
-			}
-			// Marshal the received message into JSON format.
-			messageBytes, err := json.Marshal(message)
-			if err != nil {
-				// Log fatal error if marshaling the message to JSON fails.
-				log.Fatal("marhal model response error: ", message, err)
-			}
-			{
-				tmpfile, err := os.CreateTemp("", "livestream")
-				if err != nil {
-					log.Fatalln(err)
-				}
-				//fmt.Printf("Received JSON from model, writing to %s\n", tmpfile.Name())
-				tmpfile.Write(messageBytes)
-				tmpfile.Close()
-			}
-			// Send the JSON message to the client WebSocket.
-			err = c.WriteMessage(websocket.TextMessage, messageBytes) // Use TextMessage type for JSON
-			if err != nil {
-				// Log error and break the loop if writing to the client WebSocket fails (e.g., client disconnected).
-				log.Println("write message error: ", err)
-				break
-			}
-		}
-	}()
-
-	// Main loop to read messages from the client and send to the GenAI service
-	for {
-		// Read the next message from the client WebSocket.
-		_, message, err := c.ReadMessage()
-		if err != nil {
-			// Log error and break the loop if reading from the client WebSocket fails (e.g., client disconnected).
-			log.Println("read from client error: ", err)
-			break // Exit loop on error
-		}
-		if len(message) > 0 {
-			// log.Printf(" bytes size received from client: %d", len(message))
-		}
-
-		var realtimeInput genai.LiveRealtimeInput
-		// Unmarshal the received client message into a LiveRealtimeInput struct.
-		if err := json.Unmarshal(message, &realtimeInput); err != nil {
-			// Log fatal error if unmarshaling the client message fails (e.g., invalid JSON format).
-			log.Fatal("unmarshal message error ", string(message), err)
-		}
-		// Send the unmarshaled realtime input to the GenAI service session.
-		// Note: This currently doesn't handle potential errors from SendRealtimeInput.
-		// Consider adding error handling here if needed.
-		session.SendRealtimeInput(realtimeInput)
-	}
+	return config, nil
 }
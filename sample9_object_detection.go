@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// To run this sample with a Gemini API key:
+//
+// $ export GOOGLE_API_KEY=xxxxxxxxxx
+// $ go run . -n=9
+//
+// To also get segmentation masks:
+//
+// $ go run . -n=9 -segment
+
+var segment = flag.Bool("segment", false, "sample 9: also ask for segmentation masks")
+
+// detectedObject is one item of the structured answer of the model.
+type detectedObject struct {
+	Label string `json:"label"`
+	// Box2D is [ymin, xmin, ymax, xmax], normalized to 0-1000
+	Box2D []int `json:"box_2d"`
+	// Mask is an optional base64 PNG probability map, covering only the box
+	Mask string `json:"mask,omitempty"`
+}
+
+func sample9_objectDetection(ctx context.Context) error {
+	modelName := "gemini-2.5-flash"
+
+	imgdata, err := os.ReadFile("./testdata/pool.png")
+	if err != nil {
+		return err
+	}
+
+	prompt := "Detect all the pool balls in this image. " +
+		"For each ball, output its label (e.g. \"ball 8\", or \"cue ball\") " +
+		"and its box_2d as [ymin, xmin, ymax, xmax] normalized to 0-1000."
+	objectSchema := &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"label":  {Type: genai.TypeString},
+			"box_2d": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeInteger}},
+		},
+		Required:         []string{"label", "box_2d"},
+		PropertyOrdering: []string{"label", "box_2d"},
+	}
+	if *segment {
+		prompt += " Also output the segmentation mask of each ball, " +
+			"as a base64 encoded PNG probability map covering its box, in the key \"mask\"."
+		objectSchema.Properties["mask"] = &genai.Schema{Type: genai.TypeString}
+		objectSchema.Required = append(objectSchema.Required, "mask")
+		objectSchema.PropertyOrdering = append(objectSchema.PropertyOrdering, "mask")
+	}
+	fmt.Println("Prompt:", prompt)
+	fmt.Println()
+
+	multimodalPrompt := []*genai.Content{
+		{
+			Parts: []*genai.Part{
+				genai.NewPartFromBytes(imgdata, "image/png"),
+				genai.NewPartFromText(prompt),
+			},
+		},
+	}
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   &genai.Schema{Type: genai.TypeArray, Items: objectSchema},
+		// Spatial understanding works better without thinking
+		ThinkingConfig: &genai.ThinkingConfig{ThinkingBudget: genai.Ptr[int32](0)},
+	}
+	result, err := client.Models.GenerateContent(ctx, modelName, multimodalPrompt, config)
+	if err != nil {
+		return err
+	}
+	var objects []detectedObject
+	if err := json.Unmarshal([]byte(textOf(result)), &objects); err != nil {
+		return fmt.Errorf("decoding detected objects: %w", err)
+	}
+
+	img, err := decodeImage(imgdata)
+	if err != nil {
+		return err
+	}
+	for i, obj := range objects {
+		if len(obj.Box2D) != 4 {
+			fmt.Printf("Skipping %q: invalid box %v\n", obj.Label, obj.Box2D)
+			continue
+		}
+		box := scaleBox(obj.Box2D, img.Bounds())
+		fmt.Printf("%-12s %v\n", obj.Label, box)
+		c := palette[i%len(palette)]
+		if obj.Mask != "" {
+			if err := overlayMask(img, box, obj.Mask, c); err != nil {
+				fmt.Printf("Skipping mask of %q: %v\n", obj.Label, err)
+			}
+		}
+		drawRect(img, box, c, 3)
+		drawLabel(img, box.Min, obj.Label, c)
+	}
+
+	path := "pool_annotated.png"
+	fmt.Println()
+	fmt.Println("Writing annotated image to file", path)
+	return writePNG(path, img)
+}
+
+// scaleBox converts a [ymin, xmin, ymax, xmax] box normalized to 0-1000
+// into pixel coordinates within bounds.
+func scaleBox(box2D []int, bounds image.Rectangle) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	r := image.Rect(
+		box2D[1]*w/1000,
+		box2D[0]*h/1000,
+		box2D[3]*w/1000,
+		box2D[2]*h/1000,
+	)
+	return r.Add(bounds.Min).Intersect(bounds)
+}
+
+// overlayMask decodes a base64 PNG mask, stretches it to box, and tints
+// with c the pixels of img where the mask is set.
+func overlayMask(img *image.RGBA, box image.Rectangle, b64mask string, c color.RGBA) error {
+	// The model may send a data URL
+	b64mask = b64mask[strings.Index(b64mask, ",")+1:]
+	maskdata, err := base64.StdEncoding.DecodeString(b64mask)
+	if err != nil {
+		return err
+	}
+	mask, err := decodeImage(maskdata)
+	if err != nil {
+		return err
+	}
+	mb := mask.Bounds()
+	if mb.Empty() || box.Empty() {
+		return nil
+	}
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			// Nearest neighbor
+			mx := mb.Min.X + (x-box.Min.X)*mb.Dx()/box.Dx()
+			my := mb.Min.Y + (y-box.Min.Y)*mb.Dy()/box.Dy()
+			if mask.RGBAAt(mx, my).R < 128 {
+				continue
+			}
+			p := img.RGBAAt(x, y)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8((uint16(p.R) + uint16(c.R)) / 2),
+				G: uint8((uint16(p.G) + uint16(c.G)) / 2),
+				B: uint8((uint16(p.B) + uint16(c.B)) / 2),
+				A: 255,
+			})
+		}
+	}
+	return nil
+}
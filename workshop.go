@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strings"
 
 	"google.golang.org/genai"
 )
@@ -26,6 +28,17 @@ func main() {
 
 	ctx := context.Background()
 
+	// A replayed live session doesn't call the model, so it runs without
+	// credentials.
+	if *replayPath != "" && slices.Contains(sample.capabilities, liveAPI) {
+		fmt.Println("(replaying", *replayPath+", no backend)")
+		fmt.Println()
+		if err := sample.f(ctx); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	//
 	// Create the Gemini client
 	//
@@ -44,13 +57,24 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	if client.ClientConfig().Backend == genai.BackendVertexAI {
+	backend := client.ClientConfig().Backend
+	if backend == genai.BackendVertexAI {
 		fmt.Println("(using VertexAI backend)")
 	} else {
 		fmt.Println("(using GeminiAPI backend)")
 	}
 	fmt.Println()
 
+	// Fail early, with a helpful message, instead of an opaque API error
+	if err := sample.checkBackend(backend); err != nil {
+		fmt.Fprintf(os.Stderr, "Sample %d (%s): %v\n", *N, sample.name, err)
+		if backends, err := sample.backends(); err == nil {
+			fmt.Fprintln(os.Stderr)
+			fmt.Fprintln(os.Stderr, backendSetup(backends[0]))
+		}
+		os.Exit(1)
+	}
+
 	//
 	// Run the selected sample
 	//
@@ -61,22 +85,37 @@ func main() {
 }
 
 var samples = []namedSample{
-	0: {name: "Text prompt, text answer", f: sample0_text},
-	1: {name: "Text prompt, streaming text output", f: sample1_textStream},
-	2: {name: "Multimodal prompt: text and image", f: sample2_imageInput},
-	3: {name: "Multimodal prompt: audio", f: sample3_audioInput},
-	4: {name: "Multimodal prompt: video", f: sample4_videoInput},
-	5: {name: "Generate images", f: sample5_generateImage},
-	6: {name: "Upscale image", f: sample6_upscaleImage},
-	7: {name: "Live streaming server", f: sample7_liveStreamingServer},
-	8: {name: "Forbidden Words game", f: sample8_forbiddenWords},
+	0:  {name: "Text prompt, text answer", f: sample0_text},
+	1:  {name: "Text prompt, streaming text output", f: sample1_textStream},
+	2:  {name: "Multimodal prompt: text and image", f: sample2_imageInput},
+	3:  {name: "Multimodal prompt: audio", f: sample3_audioInput},
+	4:  {name: "Multimodal prompt: video", f: sample4_videoInput},
+	5:  {name: "Generate images", f: sample5_generateImage, capabilities: []capability{imageGeneration}},
+	6:  {name: "Upscale image", f: sample6_upscaleImage, capabilities: []capability{imageUpscaling}},
+	7:  {name: "Live streaming server", f: sample7_liveStreamingServer, capabilities: []capability{liveAPI}},
+	8:  {name: "Forbidden Words game", f: sample8_forbiddenWords, capabilities: []capability{liveAPI}},
+	9:  {name: "Object detection and segmentation", f: sample9_objectDetection},
+	10: {name: "Multimodal prompt: compare several images", f: sample10_compareImages},
+	11: {name: "Image generation web gallery", f: sample11_imageGallery, capabilities: []capability{imageGeneration, imageUpscaling}},
+	12: {name: "Edit image: inpainting and outpainting", f: sample12_editImage, capabilities: []capability{imageEditing}},
+	13: {name: "Gemini native image generation and editing", f: sample13_nativeImage, capabilities: []capability{nativeImageGeneration}},
+	14: {name: "Prompt variations contact sheet", f: sample14_promptVariations, capabilities: []capability{imageGeneration}},
+	15: {name: "Evaluate generated images against their prompt", f: sample15_evaluateImages, capabilities: []capability{imageGeneration}},
 }
 
 func usage() {
 	fmt.Fprintln(os.Stderr, "Syntax:\n\tgo run . -n=N")
 	fmt.Fprintf(os.Stderr, "\nwhere N is the index of a sample:\n\n")
 	for i, s := range samples {
-		fmt.Fprintf(os.Stderr, "\t%d\t%s\n", i, s.name)
+		backends, err := s.backends()
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "\t%d\t%s (unavailable: %v)\n", i, s.name, err)
+		case slices.Equal(backends, []genai.Backend{genai.BackendVertexAI}):
+			fmt.Fprintf(os.Stderr, "\t%d\t%s (VertexAI only)\n", i, s.name)
+		default:
+			fmt.Fprintf(os.Stderr, "\t%d\t%s\n", i, s.name)
+		}
 	}
 
 	fmt.Fprintln(os.Stderr)
@@ -92,6 +131,103 @@ func usage() {
 type namedSample struct {
 	name string
 	f    func(context.Context) error
+	// capabilities are the API features that the sample relies on.
+	// They determine the backends that can run the sample.
+	capabilities []capability
+}
+
+// backends returns the backends supporting all the capabilities of the sample,
+// or an error if no backend supports them all.
+func (s namedSample) backends() ([]genai.Backend, error) {
+	backends := []genai.Backend{genai.BackendGeminiAPI, genai.BackendVertexAI}
+	for _, c := range s.capabilities {
+		backends = slices.DeleteFunc(backends, func(b genai.Backend) bool {
+			return !slices.Contains(capabilityBackends[c], b)
+		})
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no backend supports all of %q", s.capabilities)
+	}
+	return backends, nil
+}
+
+// checkBackend returns an error if the sample can't run with the given backend.
+func (s namedSample) checkBackend(backend genai.Backend) error {
+	if _, err := s.backends(); err != nil {
+		return err
+	}
+	for _, c := range s.capabilities {
+		if !slices.Contains(capabilityBackends[c], backend) {
+			return fmt.Errorf("%s is not supported by the %s backend", c, backendName(backend))
+		}
+	}
+	return nil
+}
+
+// capability is an API feature that some samples rely on.
+type capability string
+
+const (
+	imageGeneration       capability = "Imagen image generation"
+	imageUpscaling        capability = "Imagen image upscaling"
+	imageEditing          capability = "Imagen image editing"
+	nativeImageGeneration capability = "Gemini native image generation"
+	liveAPI               capability = "Live API"
+)
+
+// capabilityBackends lists the backends supporting each capability,
+// with the models used in the samples.
+var capabilityBackends = map[capability][]genai.Backend{
+	imageGeneration:       {genai.BackendVertexAI},
+	imageUpscaling:        {genai.BackendVertexAI},
+	imageEditing:          {genai.BackendVertexAI},
+	nativeImageGeneration: {genai.BackendGeminiAPI, genai.BackendVertexAI},
+	liveAPI:               {genai.BackendGeminiAPI, genai.BackendVertexAI},
+}
+
+func backendName(backend genai.Backend) string {
+	if backend == genai.BackendVertexAI {
+		return "VertexAI"
+	}
+	return "GeminiAPI"
+}
+
+// backendSetup returns the instructions to select the backend.
+func backendSetup(backend genai.Backend) string {
+	if backend == genai.BackendVertexAI {
+		return `To use the VertexAI backend:
+
+	export GOOGLE_GENAI_USE_VERTEXAI=true
+	export GOOGLE_CLOUD_PROJECT=<YOUR_PROJECT>
+	export GOOGLE_CLOUD_LOCATION=us-central1
+	gcloud auth application-default login
+	gcloud services enable aiplatform.googleapis.com`
+	}
+	return `To use the GeminiAPI backend:
+
+	export GOOGLE_GENAI_USE_VERTEXAI=false
+	export GOOGLE_API_KEY=<YOUR_API_KEY>`
+}
+
+// modelFor returns the ID of the model to use with the backend, for
+// the samples that work with both backends but whose model IDs differ.
+func modelFor(backend genai.Backend, geminiAPIModel, vertexAIModel string) string {
+	if backend == genai.BackendVertexAI {
+		return vertexAIModel
+	}
+	return geminiAPIModel
+}
+
+// stringList is a flag.Value that collects the values of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 func checkResponse(res *genai.GenerateContentResponse, err error) {
@@ -113,6 +249,29 @@ func textOf(res *genai.GenerateContentResponse) string {
 	return res.Candidates[0].Content.Parts[0].Text
 }
 
+// allTextOf concatenates the text parts of the response, e.g. when they are
+// interleaved with image parts.
+func allTextOf(res *genai.GenerateContentResponse) string {
+	checkNotEmpty(res)
+	var sb strings.Builder
+	for _, part := range res.Candidates[0].Content.Parts {
+		sb.WriteString(part.Text)
+	}
+	return sb.String()
+}
+
+// inlineImagesOf returns the images found in the response parts.
+func inlineImagesOf(res *genai.GenerateContentResponse) []*genai.Blob {
+	checkNotEmpty(res)
+	var images []*genai.Blob
+	for _, part := range res.Candidates[0].Content.Parts {
+		if part.InlineData != nil && strings.HasPrefix(part.InlineData.MIMEType, "image/") {
+			images = append(images, part.InlineData)
+		}
+	}
+	return images
+}
+
 func printTextResponse(res *genai.GenerateContentResponse) {
 	fmt.Println(textOf(res))
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestSampleBackends(t *testing.T) {
+	for i, s := range samples {
+		if _, err := s.backends(); err != nil {
+			t.Errorf("sample %d (%s): %v", i, s.name, err)
+		}
+	}
+}
+
+func TestNoBackend(t *testing.T) {
+	// No backend supports an unknown capability
+	s := namedSample{name: "test", capabilities: []capability{liveAPI, "Teleportation"}}
+	if backends, err := s.backends(); err == nil {
+		t.Errorf("backends() = %v, want an error", backends)
+	}
+	for _, backend := range []genai.Backend{genai.BackendGeminiAPI, genai.BackendVertexAI} {
+		if err := s.checkBackend(backend); err == nil {
+			t.Errorf("checkBackend(%s) = nil, want an error", backendName(backend))
+		}
+	}
+}